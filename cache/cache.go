@@ -0,0 +1,116 @@
+// Package cache は TTL 付きのインメモリレスポンスキャッシュを提供する。
+// sync.Map をバッキングストアに使い、singleflight で同一キーへの同時アクセスを
+// 1回の計算に合流させる（キャッシュスタンピード対策）。
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// entry はキャッシュに保存される1レスポンス分のデータ。
+type entry struct {
+	data      []byte
+	etag      string
+	expiresAt time.Time
+}
+
+// Cache はキー文字列 → バイト列の TTL 付きキャッシュ。ゼロ値では使えず、
+// 必ず New で生成する。
+type Cache struct {
+	store sync.Map // key string -> entry
+	group singleflight.Group
+
+	hits   uint64
+	misses uint64
+}
+
+// New は空の Cache を返す。
+func New() *Cache {
+	return &Cache{}
+}
+
+// Get はキーに対応する値を返す。TTL を超えている場合は失効として扱い false を
+// 返す（エントリ自体の削除は行わず、Set による上書きに任せる）。
+func (c *Cache) Get(key string) (data []byte, etag string, ok bool) {
+	v, found := c.store.Load(key)
+	if !found {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, "", false
+	}
+	e := v.(entry)
+	if time.Now().After(e.expiresAt) {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, "", false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return e.data, e.etag, true
+}
+
+// Set はキーに値を ttl 付きで保存し、生成した ETag を返す。
+func (c *Cache) Set(key string, data []byte, ttl time.Duration) string {
+	etag := computeETag(data)
+	c.store.Store(key, entry{
+		data:      data,
+		etag:      etag,
+		expiresAt: time.Now().Add(ttl),
+	})
+	return etag
+}
+
+// GetOrCompute はキーの値があれば返し、無ければ compute を singleflight 経由で
+// 1回だけ実行して結果を ttl 付きで保存する。同じキーへの同時呼び出しは compute
+// の完了を待って同じ結果を共有する。
+func (c *Cache) GetOrCompute(key string, ttl time.Duration, compute func() ([]byte, error)) (data []byte, etag string, err error) {
+	if data, etag, ok := c.Get(key); ok {
+		return data, etag, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// singleflight 内で再度引いておく。自分より先に同じキーの compute が
+		// 完了している可能性があるため。
+		if data, etag, ok := c.Get(key); ok {
+			return [2]string{string(data), etag}, nil
+		}
+		data, err := compute()
+		if err != nil {
+			return nil, err
+		}
+		etag := c.Set(key, data, ttl)
+		return [2]string{string(data), etag}, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	result := v.([2]string)
+	return []byte(result[0]), result[1], nil
+}
+
+// Delete はキーのエントリを削除する。
+func (c *Cache) Delete(key string) {
+	c.store.Delete(key)
+}
+
+// Flush は全エントリを削除する。`/api/admin/cache/flush` から呼ばれる。
+func (c *Cache) Flush() {
+	c.store.Range(func(key, _ interface{}) bool {
+		c.store.Delete(key)
+		return true
+	})
+}
+
+// Hits はキャッシュヒット数の累計を返す。
+func (c *Cache) Hits() uint64 { return atomic.LoadUint64(&c.hits) }
+
+// Misses はキャッシュミス数の累計を返す。
+func (c *Cache) Misses() uint64 { return atomic.LoadUint64(&c.misses) }
+
+func computeETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
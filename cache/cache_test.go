@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetSet(t *testing.T) {
+	c := New()
+
+	if _, _, ok := c.Get("missing"); ok {
+		t.Fatalf("Get on empty cache returned ok=true")
+	}
+
+	etag := c.Set("key", []byte("value"), time.Minute)
+	if etag == "" {
+		t.Fatalf("Set returned empty etag")
+	}
+
+	data, gotEtag, ok := c.Get("key")
+	if !ok || string(data) != "value" || gotEtag != etag {
+		t.Fatalf("Get = (%q, %q, %v), want (\"value\", %q, true)", data, gotEtag, ok, etag)
+	}
+}
+
+func TestGetExpiresAfterTTL(t *testing.T) {
+	c := New()
+	c.Set("key", []byte("value"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, ok := c.Get("key"); ok {
+		t.Fatalf("Get returned ok=true for an expired entry")
+	}
+}
+
+func TestGetOrCompute_CoalescesConcurrentCalls(t *testing.T) {
+	c := New()
+	var computeCount int64
+
+	compute := func() ([]byte, error) {
+		atomic.AddInt64(&computeCount, 1)
+		time.Sleep(10 * time.Millisecond)
+		return []byte("computed"), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, _, err := c.GetOrCompute("stampede-key", time.Minute, compute)
+			if err != nil {
+				t.Errorf("GetOrCompute returned error: %v", err)
+				return
+			}
+			results[i] = data
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&computeCount); got != 1 {
+		t.Errorf("compute was called %d times, want 1 (singleflight should coalesce)", got)
+	}
+	for i, r := range results {
+		if string(r) != "computed" {
+			t.Errorf("results[%d] = %q, want %q", i, r, "computed")
+		}
+	}
+}
+
+func TestGetOrCompute_PropagatesError(t *testing.T) {
+	c := New()
+	wantErr := errors.New("boom")
+
+	_, _, err := c.GetOrCompute("key", time.Minute, func() ([]byte, error) {
+		return nil, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("GetOrCompute error = %v, want %v", err, wantErr)
+	}
+	if _, _, ok := c.Get("key"); ok {
+		t.Fatalf("a failed compute should not populate the cache")
+	}
+}
+
+func TestFlushAndDelete(t *testing.T) {
+	c := New()
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+
+	c.Delete("a")
+	if _, _, ok := c.Get("a"); ok {
+		t.Fatalf("Get(\"a\") after Delete returned ok=true")
+	}
+
+	c.Flush()
+	if _, _, ok := c.Get("b"); ok {
+		t.Fatalf("Get(\"b\") after Flush returned ok=true")
+	}
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	c := New()
+	c.Get("missing")
+	c.Set("key", []byte("value"), time.Minute)
+	c.Get("key")
+	c.Get("key")
+
+	if c.Misses() != 1 {
+		t.Errorf("Misses() = %d, want 1", c.Misses())
+	}
+	if c.Hits() != 2 {
+		t.Errorf("Hits() = %d, want 2", c.Hits())
+	}
+}
@@ -0,0 +1,97 @@
+// Package geo は緯度経度にまつわる幾何計算（距離計算、線分への投影）をまとめる。
+package geo
+
+import "math"
+
+// EarthRadiusMeters は haversine 計算で使う地球半径。
+const EarthRadiusMeters = 6371000.0
+
+// HaversineMeters は2点間の大圏距離をメートルで返す。
+func HaversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return EarthRadiusMeters * c
+}
+
+// ProjectionResult は点を線分列（線文字列）に投影した結果。
+type ProjectionResult struct {
+	// DistanceMeters は点から線文字列までの最短距離。
+	DistanceMeters float64
+	// ClosestIndex は最も近い区間の始点インデックス（coords[ClosestIndex] 側）。
+	ClosestIndex int
+}
+
+// DistanceFromLineString は point（[lng, lat]）と coords（[][lng, lat] の
+// 線文字列）の各区間への垂線距離を調べ、最短距離とその区間の始点インデックスを
+// 返す。区間への投影は緯度による経度方向の歪みを補正した局所正距円筒図法
+// （経度を cos(lat) でスケール）で行い、距離そのものは haversine で測る。
+func DistanceFromLineString(point [2]float64, coords [][]float64) ProjectionResult {
+	best := ProjectionResult{DistanceMeters: math.Inf(1), ClosestIndex: 0}
+
+	if len(coords) == 0 {
+		return best
+	}
+	if len(coords) == 1 {
+		return ProjectionResult{
+			DistanceMeters: HaversineMeters(point[1], point[0], coords[0][1], coords[0][0]),
+			ClosestIndex:   0,
+		}
+	}
+
+	for i := 0; i < len(coords)-1; i++ {
+		a := coords[i]
+		b := coords[i+1]
+
+		projLat, projLng := projectOnSegment(point[1], point[0], a[1], a[0], b[1], b[0])
+		d := HaversineMeters(point[1], point[0], projLat, projLng)
+		if d < best.DistanceMeters {
+			best.DistanceMeters = d
+			best.ClosestIndex = i
+		}
+	}
+
+	return best
+}
+
+// projectOnSegment は点 P を線分 AB（緯度経度）に投影し、投影点の緯度経度を返す。
+// 経度は cos(lat) でスケールした局所正距円筒図法で扱うことで、
+// 緯度方向と経度方向のスケール差による歪みを避ける。
+func projectOnSegment(pLat, pLng, aLat, aLng, bLat, bLng float64) (float64, float64) {
+	cosLat := math.Cos(aLat * math.Pi / 180)
+
+	ax, ay := aLng*cosLat, aLat
+	bx, by := bLng*cosLat, bLat
+	px, py := pLng*cosLat, pLat
+
+	abx, aby := bx-ax, by-ay
+	abLenSq := abx*abx + aby*aby
+
+	if abLenSq == 0 {
+		return aLat, aLng
+	}
+
+	t := ((px-ax)*abx + (py-ay)*aby) / abLenSq
+	t = clamp(t, 0, 1)
+
+	projX := ax + t*abx
+	projY := ay + t*aby
+
+	return projY, projX / cosLat
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineMeters(t *testing.T) {
+	d := HaversineMeters(0, 0, 0, 0)
+	if d != 0 {
+		t.Errorf("distance between identical points = %v, want 0", d)
+	}
+
+	// 仙台駅付近の2点、約1km離れた緯度差で検算する。
+	d = HaversineMeters(38.2600, 140.8800, 38.2690, 140.8800)
+	if d < 900 || d > 1100 {
+		t.Errorf("distance = %v, want ~1000m", d)
+	}
+}
+
+func TestDistanceFromLineString_OnSegment(t *testing.T) {
+	coords := [][]float64{{140.0, 38.0}, {140.01, 38.0}}
+	// 区間の中間点ちょうど上の点なので距離はほぼ0。
+	result := DistanceFromLineString([2]float64{140.005, 38.0}, coords)
+	if result.DistanceMeters > 1 {
+		t.Errorf("distance = %v, want ~0", result.DistanceMeters)
+	}
+	if result.ClosestIndex != 0 {
+		t.Errorf("closestIndex = %d, want 0", result.ClosestIndex)
+	}
+}
+
+func TestDistanceFromLineString_PicksNearestSegment(t *testing.T) {
+	coords := [][]float64{{140.0, 38.0}, {140.01, 38.0}, {140.01, 38.01}}
+	// 2番目の区間 (140.01,38.0)-(140.01,38.01) の近くの点。
+	result := DistanceFromLineString([2]float64{140.011, 38.005}, coords)
+	if result.ClosestIndex != 1 {
+		t.Errorf("closestIndex = %d, want 1", result.ClosestIndex)
+	}
+}
+
+func TestDistanceFromLineString_EmptyCoords(t *testing.T) {
+	result := DistanceFromLineString([2]float64{140.0, 38.0}, nil)
+	if !math.IsInf(result.DistanceMeters, 1) {
+		t.Errorf("distance for empty coords = %v, want +Inf", result.DistanceMeters)
+	}
+}
@@ -0,0 +1,83 @@
+package realtime
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultRefreshInterval はフィードをポーリングする間隔のデフォルト値。
+const DefaultRefreshInterval = 15 * time.Second
+
+// Config はポーリング対象フィードの接続設定。新しい都市を追加する際は
+// config.json を用意するか環境変数を設定するだけでよく、コード変更は不要。
+type Config struct {
+	// FeedURL は GTFS-Realtime FeedMessage を配信するエンドポイント。
+	FeedURL string `json:"feed_url"`
+	// Headers は Entur/IDFM などが要求する API キー等の追加ヘッダー。
+	Headers map[string]string `json:"headers"`
+	// RefreshIntervalSec はポーリング間隔（秒）。0 の場合は DefaultRefreshInterval。
+	RefreshIntervalSec int `json:"refresh_interval_sec"`
+	// StaleTTLSec はレコードを保持する秒数。0 の場合は DefaultStaleTTL。
+	StaleTTLSec int `json:"stale_ttl_sec"`
+}
+
+// RefreshInterval は設定値を time.Duration に変換したもの。
+func (c Config) RefreshInterval() time.Duration {
+	if c.RefreshIntervalSec <= 0 {
+		return DefaultRefreshInterval
+	}
+	return time.Duration(c.RefreshIntervalSec) * time.Second
+}
+
+// StaleTTL は設定値を time.Duration に変換したもの。
+func (c Config) StaleTTL() time.Duration {
+	if c.StaleTTLSec <= 0 {
+		return DefaultStaleTTL
+	}
+	return time.Duration(c.StaleTTLSec) * time.Second
+}
+
+// Enabled は FeedURL が設定されているかどうか。空の場合ポーラーは起動しない。
+func (c Config) Enabled() bool {
+	return c.FeedURL != ""
+}
+
+// LoadConfig は path の config.json を読み込み、GTFSRT_* 環境変数で個々の
+// 値を上書きする。ファイルが存在しない場合は環境変数のみから設定を組み立てる。
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return Config{}, err
+		}
+	} else if !os.IsNotExist(err) {
+		return Config{}, err
+	}
+
+	if v := os.Getenv("GTFSRT_FEED_URL"); v != "" {
+		cfg.FeedURL = v
+	}
+	if v := os.Getenv("GTFSRT_REFRESH_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RefreshIntervalSec = n
+		}
+	}
+	if v := os.Getenv("GTFSRT_STALE_TTL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.StaleTTLSec = n
+		}
+	}
+	if v := os.Getenv("GTFSRT_API_KEY_HEADER"); v != "" {
+		if cfg.Headers == nil {
+			cfg.Headers = make(map[string]string)
+		}
+		if key := os.Getenv("GTFSRT_API_KEY_VALUE"); key != "" {
+			cfg.Headers[v] = key
+		}
+	}
+
+	return cfg, nil
+}
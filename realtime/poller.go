@@ -0,0 +1,150 @@
+package realtime
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// Poller は FeedURL を一定間隔でポーリングし、既知の便（KnownTrip が true を
+// 返す trip_id）の VehiclePosition / TripUpdate だけを Cache に反映する。
+type Poller struct {
+	cfg   Config
+	Cache *RealtimeCache
+	// KnownTrip は timetablesCache に存在する trip_id かどうかを判定する。
+	// 未知の便の実体は破棄し、キャッシュを無駄に太らせない。
+	KnownTrip func(tripID string) bool
+
+	client *http.Client
+}
+
+// NewPoller は cfg に従ってポーリングする Poller を作る。
+func NewPoller(cfg Config, cache *RealtimeCache, knownTrip func(string) bool) *Poller {
+	return &Poller{
+		cfg:       cfg,
+		Cache:     cache,
+		KnownTrip: knownTrip,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run はフィードのポーリングを開始し、stop がクローズされるまでブロックする。
+// 呼び出し側は go poller.Run(stop) の形で goroutine として起動する。
+func (p *Poller) Run(stop <-chan struct{}) {
+	if !p.cfg.Enabled() {
+		log.Println("realtime: GTFSRT_FEED_URL が未設定のためポーリングを開始しません")
+		return
+	}
+
+	ticker := time.NewTicker(p.cfg.RefreshInterval())
+	defer ticker.Stop()
+
+	p.pollOnce()
+	for {
+		select {
+		case <-ticker.C:
+			p.pollOnce()
+			p.Cache.Sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *Poller) pollOnce() {
+	feed, err := p.fetch()
+	if err != nil {
+		log.Printf("realtime: フィード取得に失敗しました: %v", err)
+		return
+	}
+
+	for _, entity := range feed.GetEntity() {
+		if vp := entity.GetVehicle(); vp != nil {
+			p.applyVehiclePosition(vp)
+		}
+		if tu := entity.GetTripUpdate(); tu != nil {
+			p.applyTripUpdate(tu)
+		}
+	}
+}
+
+func (p *Poller) applyVehiclePosition(vp *gtfs.VehiclePosition) {
+	tripID := vp.GetTrip().GetTripId()
+	if tripID == "" || !p.KnownTrip(tripID) {
+		return
+	}
+	pos := vp.GetPosition()
+	if pos == nil {
+		return
+	}
+
+	rec, _ := p.Cache.Get(tripID)
+	rec.Vehicle = &VehicleRecord{
+		Lat:             float64(pos.GetLatitude()),
+		Lng:             float64(pos.GetLongitude()),
+		Speed:           float64(pos.GetSpeed()),
+		Bearing:         float64(pos.GetBearing()),
+		OccupancyStatus: vp.GetOccupancyStatus().String(),
+	}
+	p.Cache.Set(tripID, rec)
+}
+
+func (p *Poller) applyTripUpdate(tu *gtfs.TripUpdate) {
+	tripID := tu.GetTrip().GetTripId()
+	if tripID == "" || !p.KnownTrip(tripID) {
+		return
+	}
+
+	// 遅延は直近（最初）の StopTimeUpdate から取る。終点の delay を使うと、
+	// 現在は遅れていても終点までに回復する予定の便の遅延が 0 扱いになって
+	// しまい、ライブの遅れが隠れてしまう。
+	delaySec := 0
+	if stus := tu.GetStopTimeUpdate(); len(stus) > 0 {
+		next := stus[0]
+		if d := next.GetArrival(); d != nil && d.Delay != nil {
+			delaySec = int(d.GetDelay())
+		} else if d := next.GetDeparture(); d != nil && d.Delay != nil {
+			delaySec = int(d.GetDelay())
+		}
+	}
+
+	rec, _ := p.Cache.Get(tripID)
+	rec.TripUpdate = &TripUpdateRecord{DelaySec: delaySec}
+	p.Cache.Set(tripID, rec)
+}
+
+func (p *Poller) fetch() (*gtfs.FeedMessage, error) {
+	req, err := http.NewRequest(http.MethodGet, p.cfg.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("realtime: unexpected status %d from %s", resp.StatusCode, p.cfg.FeedURL)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &gtfs.FeedMessage{}
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,70 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+func delayPtr(d int32) *int32 { return &d }
+
+func TestApplyTripUpdate_UsesNextStopDelayNotTerminus(t *testing.T) {
+	cache := NewRealtimeCache(DefaultStaleTTL)
+	poller := NewPoller(Config{}, cache, func(string) bool { return true })
+
+	tripID := "T1"
+	tu := &gtfs.TripUpdate{
+		Trip: &gtfs.TripDescriptor{TripId: &tripID},
+		StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
+			{Arrival: &gtfs.TripUpdate_StopTimeEvent{Delay: delayPtr(600)}}, // 次の停留所: 10分遅れ
+			{Arrival: &gtfs.TripUpdate_StopTimeEvent{Delay: delayPtr(0)}},   // 終点: 回復見込み
+		},
+	}
+
+	poller.applyTripUpdate(tu)
+
+	rec, ok := cache.Get(tripID)
+	if !ok || rec.TripUpdate == nil {
+		t.Fatalf("expected a cached TripUpdate record")
+	}
+	if rec.TripUpdate.DelaySec != 600 {
+		t.Errorf("DelaySec = %d, want 600 (next stop's delay, not the terminus's)", rec.TripUpdate.DelaySec)
+	}
+}
+
+func TestApplyTripUpdate_FallsBackToDeparture(t *testing.T) {
+	cache := NewRealtimeCache(DefaultStaleTTL)
+	poller := NewPoller(Config{}, cache, func(string) bool { return true })
+
+	tripID := "T2"
+	tu := &gtfs.TripUpdate{
+		Trip: &gtfs.TripDescriptor{TripId: &tripID},
+		StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
+			{Departure: &gtfs.TripUpdate_StopTimeEvent{Delay: delayPtr(120)}},
+		},
+	}
+
+	poller.applyTripUpdate(tu)
+
+	rec, _ := cache.Get(tripID)
+	if rec.TripUpdate == nil || rec.TripUpdate.DelaySec != 120 {
+		t.Errorf("DelaySec = %+v, want 120 from departure delay", rec.TripUpdate)
+	}
+}
+
+func TestApplyTripUpdate_UnknownTripIsIgnored(t *testing.T) {
+	cache := NewRealtimeCache(DefaultStaleTTL)
+	poller := NewPoller(Config{}, cache, func(string) bool { return false })
+
+	tripID := "unknown"
+	tu := &gtfs.TripUpdate{
+		Trip:           &gtfs.TripDescriptor{TripId: &tripID},
+		StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{{Arrival: &gtfs.TripUpdate_StopTimeEvent{Delay: delayPtr(60)}}},
+	}
+
+	poller.applyTripUpdate(tu)
+
+	if _, ok := cache.Get(tripID); ok {
+		t.Errorf("expected unknown trip_id to be discarded, but it was cached")
+	}
+}
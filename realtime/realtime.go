@@ -0,0 +1,101 @@
+// Package realtime は GTFS-Realtime フィード（Protocol Buffers over HTTP）を
+// 定期的にポーリングし、便（trip_id）ごとの最新の車両位置・遅延情報を保持する。
+// スケジュールベースの位置補間は、ここに有効なレコードがある便についてのみ
+// 実測値で上書きされる。
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStaleTTL はレコードを保持する期間。これを超えたレコードは破棄され、
+// 呼び出し側は時刻表ベースの補間にフォールバックする。
+const DefaultStaleTTL = 90 * time.Second
+
+// VehicleRecord は GTFS-RT の VehiclePosition から抽出した実測位置情報。
+type VehicleRecord struct {
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	Speed           float64 `json:"speed,omitempty"`
+	Bearing         float64 `json:"bearing,omitempty"`
+	OccupancyStatus string  `json:"occupancy_status,omitempty"`
+}
+
+// TripUpdateRecord は GTFS-RT の TripUpdate から抽出した遅延情報。
+// DelaySec は該当便の直近の StopTimeUpdate から得られる遅延秒数（進みは負値）。
+type TripUpdateRecord struct {
+	DelaySec int `json:"delay_sec"`
+}
+
+// Record は trip_id ごとにキャッシュされるリアルタイム情報。
+// `/api/buses/:tripId/realtime` はこのフィールドに timestamp_age_sec を加えて返す。
+type Record struct {
+	TripID     string            `json:"trip_id"`
+	Vehicle    *VehicleRecord    `json:"vehicle,omitempty"`
+	TripUpdate *TripUpdateRecord `json:"trip_update,omitempty"`
+	UpdatedAt  time.Time         `json:"-"`
+}
+
+// TimestampAgeSec はレコードが観測されてから経過した秒数。
+func (r Record) TimestampAgeSec() int64 {
+	return int64(time.Since(r.UpdatedAt).Seconds())
+}
+
+// RealtimeCache は trip_id → Record のスレッドセーフなストアで、TTL 経過後の
+// エントリは失効扱い（Get が false を返す）になる。
+type RealtimeCache struct {
+	mu      sync.RWMutex
+	records map[string]Record
+	ttl     time.Duration
+}
+
+// NewRealtimeCache は ttl<=0 の場合 DefaultStaleTTL を使う RealtimeCache を作る。
+func NewRealtimeCache(ttl time.Duration) *RealtimeCache {
+	if ttl <= 0 {
+		ttl = DefaultStaleTTL
+	}
+	return &RealtimeCache{
+		records: make(map[string]Record),
+		ttl:     ttl,
+	}
+}
+
+// Set は tripID のレコードを保存し、観測時刻を現在時刻で打つ。
+func (c *RealtimeCache) Set(tripID string, rec Record) {
+	rec.TripID = tripID
+	rec.UpdatedAt = time.Now()
+	c.mu.Lock()
+	c.records[tripID] = rec
+	c.mu.Unlock()
+}
+
+// Get は tripID のレコードを返す。TTL を超えている場合は失効として扱う。
+func (c *RealtimeCache) Get(tripID string) (Record, bool) {
+	c.mu.RLock()
+	rec, ok := c.records[tripID]
+	c.mu.RUnlock()
+	if !ok || time.Since(rec.UpdatedAt) > c.ttl {
+		return Record{}, false
+	}
+	return rec, true
+}
+
+// Sweep は TTL を超過したレコードを削除する。ポーリングのたびに呼ぶ想定。
+func (c *RealtimeCache) Sweep() {
+	cutoff := time.Now().Add(-c.ttl)
+	c.mu.Lock()
+	for tripID, rec := range c.records {
+		if rec.UpdatedAt.Before(cutoff) {
+			delete(c.records, tripID)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Len はテスト・監視用に現在保持しているレコード数を返す。
+func (c *RealtimeCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.records)
+}
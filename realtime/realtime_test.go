@@ -0,0 +1,50 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRealtimeCache_GetReturnsWithinTTL(t *testing.T) {
+	c := NewRealtimeCache(50 * time.Millisecond)
+	c.Set("T1", Record{Vehicle: &VehicleRecord{Lat: 38.0, Lng: 140.0}})
+
+	rec, ok := c.Get("T1")
+	if !ok || rec.Vehicle == nil {
+		t.Fatalf("expected a fresh record to be returned")
+	}
+}
+
+func TestRealtimeCache_GetExpiresAfterTTL(t *testing.T) {
+	c := NewRealtimeCache(10 * time.Millisecond)
+	c.Set("T1", Record{Vehicle: &VehicleRecord{Lat: 38.0, Lng: 140.0}})
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := c.Get("T1"); ok {
+		t.Errorf("expected a stale record to be reported as missing")
+	}
+}
+
+func TestRealtimeCache_SweepRemovesStaleEntriesOnly(t *testing.T) {
+	c := NewRealtimeCache(20 * time.Millisecond)
+	c.Set("stale", Record{Vehicle: &VehicleRecord{Lat: 1, Lng: 1}})
+	time.Sleep(30 * time.Millisecond)
+	c.Set("fresh", Record{Vehicle: &VehicleRecord{Lat: 2, Lng: 2}})
+
+	c.Sweep()
+
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1 (only the fresh entry survives)", c.Len())
+	}
+	if _, ok := c.Get("fresh"); !ok {
+		t.Errorf("expected the fresh entry to survive Sweep")
+	}
+}
+
+func TestNewRealtimeCache_NonPositiveTTLFallsBackToDefault(t *testing.T) {
+	c := NewRealtimeCache(0)
+	if c.ttl != DefaultStaleTTL {
+		t.Errorf("ttl = %v, want DefaultStaleTTL", c.ttl)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Haruday0/sendai-bus-map-v2/cache"
+)
+
+// エンドポイントごとのキャッシュ TTL。数値そのものの意味は各エンドポイントの
+// 更新頻度に合わせて選んでいる（/api/buses は位置補間の量子と同じ3秒）。
+const (
+	stopsCacheTTL     = 7 * 24 * time.Hour
+	busesCacheTTL     = 3 * time.Second
+	timetableCacheTTL = time.Hour
+	tripCacheTTL      = time.Hour
+)
+
+// responseCache はハンドラのレスポンスを TTL 付きでキャッシュする共有インスタンス。
+var responseCache = cache.New()
+
+// cacheJSON は key のキャッシュがあればそれをそのまま返し、無ければ fn を
+// singleflight 経由で1回だけ実行してから TTL 付きで保存する。ETag /
+// Cache-Control を付与し、If-None-Match が一致すれば 304 を返す。
+func cacheJSON(key string, ttl time.Duration, c *gin.Context, fn func() (interface{}, error)) {
+	data, etag, err := responseCache.GetOrCompute(key, ttl, func() ([]byte, error) {
+		v, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// registerCacheAdminRoutes は /api/admin/cache/flush と /metrics を登録する。
+// flush は CACHE_ADMIN_TOKEN 環境変数と一致する Authorization: Bearer <token>
+// が無いと 401 を返す。
+func registerCacheAdminRoutes(r *gin.Engine) {
+	r.POST("/api/admin/cache/flush", func(c *gin.Context) {
+		token := os.Getenv("CACHE_ADMIN_TOKEN")
+		if token == "" || c.GetHeader("Authorization") != "Bearer "+token {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "認証が必要です"})
+			return
+		}
+		responseCache.Flush()
+		c.JSON(http.StatusOK, gin.H{"flushed": true})
+	})
+
+	r.GET("/metrics", func(c *gin.Context) {
+		c.String(http.StatusOK,
+			"# HELP bus_api_cache_hits_total Total number of response cache hits\n"+
+				"# TYPE bus_api_cache_hits_total counter\n"+
+				"bus_api_cache_hits_total %d\n"+
+				"# HELP bus_api_cache_misses_total Total number of response cache misses\n"+
+				"# TYPE bus_api_cache_misses_total counter\n"+
+				"bus_api_cache_misses_total %d\n",
+			responseCache.Hits(), responseCache.Misses())
+	})
+}
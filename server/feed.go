@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Haruday0/sendai-bus-map-v2/realtime"
+)
+
+// FeedManifestEntry は feeds.json の1エントリ。新しい都市を追加する場合は
+// このエントリを1つ足すだけでよく、コード変更は不要。
+type FeedManifestEntry struct {
+	FeedID      string `json:"feed_id"`
+	DataDir     string `json:"data_dir"`
+	DisplayName string `json:"display_name"`
+	Timezone    string `json:"timezone"`
+	GTFSRTURL   string `json:"gtfs_rt_url"`
+}
+
+// Feed は1つの事業者（都市）分の GTFS データと、それに紐づくキャッシュ一式。
+// 複数事業者をホストする場合、feedsCache にこの構造体を feed_id ごとに保持する。
+type Feed struct {
+	ID          string
+	DisplayName string
+	DataDir     string
+	Location    *time.Location
+	GTFSRTURL   string
+
+	Stops      StopsData
+	Timetables TimetablesData
+	Shapes     ShapesData
+	Calendar   CalendarData
+	Extra      ExtraData
+	Routes     RoutesData
+
+	// Realtime は GTFS-Realtime ポーラーが書き込む trip_id 単位の最新情報。
+	// フィードごとに独立しており、他フィードの便を巻き込まない。
+	Realtime *realtime.RealtimeCache
+
+	// バウンディングボックス（起動時に Stops から算出）。/api/feeds や
+	// クロスフィード検索（どのフィードに問い合わせるべきか）で使う。
+	MinLat, MaxLat, MinLng, MaxLng float64
+
+	// raptorOnce/raptorCache は経路探索用の前処理済みテーブル（raptor.go）。
+	// Feed は loadFeeds の再実行のたびに新しい *Feed として作り直されるため、
+	// ここに sync.Once で持たせるだけで再読み込み時の自動的な無効化になる。
+	raptorOnce  sync.Once
+	raptorCache *raptorTables
+}
+
+// Bounds はクライアント向けのバウンディングボックス表現。
+type Bounds struct {
+	MinLat float64 `json:"min_lat"`
+	MaxLat float64 `json:"max_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// FeedSummary は GET /api/feeds のレスポンス要素。
+type FeedSummary struct {
+	FeedID      string `json:"feed_id"`
+	DisplayName string `json:"display_name"`
+	Timezone    string `json:"timezone"`
+	Bounds      Bounds `json:"bounds"`
+}
+
+// Summary はこのフィードの FeedSummary を返す。
+func (f *Feed) Summary() FeedSummary {
+	return FeedSummary{
+		FeedID:      f.ID,
+		DisplayName: f.DisplayName,
+		Timezone:    f.Location.String(),
+		Bounds: Bounds{
+			MinLat: f.MinLat,
+			MaxLat: f.MaxLat,
+			MinLng: f.MinLng,
+			MaxLng: f.MaxLng,
+		},
+	}
+}
+
+// ContainsPoint はフィードのバウンディングボックスが (lat, lng) を含むか。
+func (f *Feed) ContainsPoint(lat, lng float64) bool {
+	return lat >= f.MinLat && lat <= f.MaxLat && lng >= f.MinLng && lng <= f.MaxLng
+}
+
+// feedsCache は feed_id → *Feed。起動時に loadFeeds で一度だけ構築され、
+// 以降は読み取り専用として扱う（既存の各種 XxxCache と同じ前提）。
+var feedsCache map[string]*Feed
+
+// defaultFeedIDValue はフィード指定なしの（後方互換）エンドポイントが使う
+// フィード ID。フィードが1つしか無い場合はそれ、複数ある場合は
+// feeds.json 内で最初に現れたものを既定とする。
+var defaultFeedIDValue string
+
+// loadFeeds は feeds.json（無ければ単一フィードの既定値）を読み込み、各フィード
+// のデータを1フィード1 goroutine で並行ロードする。フィード数が増えても起動時間
+// が線形に伸びないようにするための措置。
+func loadFeeds(manifestPath string) error {
+	manifest, err := readFeedManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		return fmt.Errorf("feeds: feeds.json にフィードが1件もありません")
+	}
+
+	feeds := make(map[string]*Feed, len(manifest))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(manifest))
+
+	for _, entry := range manifest {
+		entry := entry
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			feed, err := loadFeed(entry)
+			if err != nil {
+				errCh <- fmt.Errorf("feeds: %s のロードに失敗しました: %w", entry.FeedID, err)
+				return
+			}
+			mu.Lock()
+			feeds[entry.FeedID] = feed
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		return err
+	}
+
+	feedsCache = feeds
+	defaultFeedIDValue = manifest[0].FeedID
+
+	log.Printf("%d件のフィードを読み込みました", len(feedsCache))
+	return nil
+}
+
+// readFeedManifest は manifestPath を読む。存在しない場合は、既存の ../data
+// ディレクトリをそのまま使う単一フィード（feed_id="default"）を返すことで
+// これまでの単一都市構成と後方互換を保つ。
+func readFeedManifest(manifestPath string) ([]FeedManifestEntry, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []FeedManifestEntry{{
+				FeedID:      "default",
+				DataDir:     "../data",
+				DisplayName: "仙台市営バス",
+				Timezone:    "Asia/Tokyo",
+			}}, nil
+		}
+		return nil, err
+	}
+
+	var manifest []FeedManifestEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// loadFeed は1フィード分の GTFS 派生 JSON 一式を DataDir から読み込む。
+func loadFeed(entry FeedManifestEntry) (*Feed, error) {
+	loc, err := time.LoadLocation(entry.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone %q: %w", entry.Timezone, err)
+	}
+
+	feed := &Feed{
+		ID:          entry.FeedID,
+		DisplayName: entry.DisplayName,
+		DataDir:     entry.DataDir,
+		Location:    loc,
+		GTFSRTURL:   entry.GTFSRTURL,
+		Realtime:    realtime.NewRealtimeCache(realtime.DefaultStaleTTL),
+	}
+
+	if err := readJSONFile(filepath.Join(entry.DataDir, "stops.json"), &feed.Stops); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(entry.DataDir, "timetables.json"), &feed.Timetables); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(entry.DataDir, "shapes.json"), &feed.Shapes); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(entry.DataDir, "calendar.json"), &feed.Calendar); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(entry.DataDir, "extra.json"), &feed.Extra); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(entry.DataDir, "routes.json"), &feed.Routes); err != nil {
+		return nil, err
+	}
+
+	feed.computeBounds()
+
+	log.Printf("[%s] バス停%d件・経路%d件・路線%d件を読み込みました", feed.ID, len(feed.Stops), len(feed.Shapes), len(feed.Routes))
+	return feed, nil
+}
+
+func readJSONFile(path string, target interface{}) error {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(file, target)
+}
+
+// computeBounds は Stops からバウンディングボックスを算出する。
+func (f *Feed) computeBounds() {
+	f.MinLat, f.MinLng = math.Inf(1), math.Inf(1)
+	f.MaxLat, f.MaxLng = math.Inf(-1), math.Inf(-1)
+
+	for _, stop := range f.Stops {
+		if stop.Lat < f.MinLat {
+			f.MinLat = stop.Lat
+		}
+		if stop.Lat > f.MaxLat {
+			f.MaxLat = stop.Lat
+		}
+		if stop.Lng < f.MinLng {
+			f.MinLng = stop.Lng
+		}
+		if stop.Lng > f.MaxLng {
+			f.MaxLng = stop.Lng
+		}
+	}
+}
+
+// defaultFeed はフィード指定の無い後方互換エンドポイントが使うフィードを返す。
+func defaultFeed() *Feed {
+	return feedsCache[defaultFeedIDValue]
+}
+
+// resolveFeed はリクエストの :feedId パラメータからフィードを引く。
+// パラメータが無い場合は defaultFeed を返す。存在しない feed_id の場合は
+// 404 を書き込んで ok=false を返す。
+func resolveFeed(c *gin.Context) (*Feed, bool) {
+	feedID := c.Param("feedId")
+	if feedID == "" {
+		if f := defaultFeed(); f != nil {
+			return f, true
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "フィードが設定されていません"})
+		return nil, false
+	}
+
+	f, ok := feedsCache[feedID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "指定されたフィードが見つかりません"})
+		return nil, false
+	}
+	return f, true
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Haruday0/sendai-bus-map-v2/geo"
+	"github.com/Haruday0/sendai-bus-map-v2/realtime"
+)
+
+// nowInFeed はフィードのタイムゾーンでの現在時刻と、その日内の経過秒数を返す。
+// フィードごとに time.Location を持つのは、JST 以外のフィードが混在しても
+// isServiceRunningToday が正しいローカル日付で運行判定できるようにするため。
+func (f *Feed) nowInFeed() (time.Time, int) {
+	now := time.Now().In(f.Location)
+	nowSec := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	return now, nowSec
+}
+
+// 現在のサービスが運行中かチェック（フィードのローカル日付で判定）
+func (f *Feed) isServiceRunningToday(serviceID string) bool {
+	now, _ := f.nowInFeed()
+	return f.isServiceRunningOn(serviceID, now)
+}
+
+// isServiceRunningOn は isServiceRunningToday と同じ判定ロジックを、任意の日付
+// （経路探索などで「今日」ではない日を指定したい場合）に対して行う。
+func (f *Feed) isServiceRunningOn(serviceID string, date time.Time) bool {
+	ymd := date.Format("20060102")
+
+	// 例外日チェック
+	for _, exception := range f.Extra.CalendarDates {
+		if exception.Date == ymd && exception.ServiceID == serviceID {
+			return exception.ExceptionType == "1"
+		}
+	}
+
+	// カレンダーチェック
+	cal, ok := f.Calendar[serviceID]
+	if !ok {
+		return false
+	}
+
+	if ymd >= cal.Start && ymd <= cal.End {
+		// GTFS形式: 月曜=0, 日曜=6
+		gtfsDayIdx := (int(date.Weekday()) + 6) % 7
+		if gtfsDayIdx < len(cal.Days) {
+			return cal.Days[gtfsDayIdx] == "1"
+		}
+	}
+
+	// 期限切れフォールバック
+	startDate, _ := time.ParseInLocation("20060102", cal.Start, f.Location)
+	endDate, _ := time.ParseInLocation("20060102", cal.End, f.Location)
+	durationDays := endDate.Sub(startDate).Hours() / 24
+
+	if durationDays >= 20 {
+		gtfsDayIdx := (int(date.Weekday()) + 6) % 7
+		if gtfsDayIdx < len(cal.Days) {
+			return cal.Days[gtfsDayIdx] == "1"
+		}
+	}
+
+	return false
+}
+
+// 範囲内のバス停をフィルタリング
+func (f *Feed) filterStopsByBounds(minLat, maxLat, minLng, maxLng float64) map[string]StopInfo {
+	result := make(map[string]StopInfo)
+
+	for stopID, stop := range f.Stops {
+		if stop.Lat >= minLat && stop.Lat <= maxLat &&
+			stop.Lng >= minLng && stop.Lng <= maxLng {
+			result[stopID] = stop
+		}
+	}
+
+	return result
+}
+
+// バス位置を計算
+func (f *Feed) calculateBusPosition(trip TripInfo, nowSec int, patternKey string) []float64 {
+	shape, ok := f.Shapes[patternKey]
+	if !ok || len(shape.Coordinates) == 0 || len(shape.StopIndices) == 0 {
+		return nil
+	}
+
+	stops := trip.Stops
+	coords := shape.Coordinates
+	indices := shape.StopIndices
+
+	for i := 0; i < len(stops)-1; i++ {
+		s1 := timeToSec(stops[i].Time)
+		s2 := timeToSec(stops[i+1].Time)
+
+		if nowSec >= s1 && nowSec < s2 {
+			timeRatio := float64(nowSec-s1) / float64(s2-s1)
+			targetIndex := int(math.Floor(float64(indices[i]) + float64(indices[i+1]-indices[i])*timeRatio))
+			if targetIndex >= len(coords) {
+				targetIndex = len(coords) - 1
+			}
+			return coords[targetIndex]
+		}
+	}
+
+	return nil
+}
+
+// resolveBusPosition は GTFS-RT の実測値があればそれを優先し、TripUpdate しか
+// 無ければ遅延を時刻表に反映してから通常のシェイプ補間を行う。戻り値の Record
+// は実測値があった場合のみ非 nil で、speed/bearing 等を呼び出し元で使う。
+func (f *Feed) resolveBusPosition(tripID string, trip TripInfo, nowSec int, patternKey string) ([]float64, *realtime.Record) {
+	if rec, ok := f.Realtime.Get(tripID); ok {
+		if rec.Vehicle != nil {
+			return []float64{rec.Vehicle.Lng, rec.Vehicle.Lat}, &rec
+		}
+		if rec.TripUpdate != nil {
+			delayedTrip := trip
+			delayedTrip.Stops = applyDelayToStops(trip.Stops, rec.TripUpdate.DelaySec)
+			return f.calculateBusPosition(delayedTrip, nowSec, patternKey), nil
+		}
+	}
+	return f.calculateBusPosition(trip, nowSec, patternKey), nil
+}
+
+// 現在運行中のバス位置を全て計算
+func (f *Feed) calculateAllBusPositions() []BusPosition {
+	_, nowSec := f.nowInFeed()
+
+	result := []BusPosition{}
+
+	for routeID, trips := range f.Timetables {
+		for tripID, trip := range trips {
+			// サービス運行チェック
+			if !f.isServiceRunningToday(trip.ServiceID) {
+				continue
+			}
+
+			stops := trip.Stops
+			if len(stops) < 2 {
+				continue
+			}
+
+			// 運行時間内かチェック
+			startSec := timeToSec(stops[0].Time)
+			endSec := timeToSec(stops[len(stops)-1].Time)
+
+			if nowSec >= startSec && nowSec <= endSec {
+				// パターンキーを生成
+				stopIDs := make([]string, len(stops))
+				for i, stop := range stops {
+					stopIDs[i] = stop.StopID
+				}
+				patternKey := strings.Join(stopIDs, "|")
+
+				// 位置計算（GTFS-RT の実測値があれば優先）
+				pos, rt := f.resolveBusPosition(tripID, trip, nowSec, patternKey)
+				if pos != nil {
+					routeInfo := f.Routes[routeID]
+					bp := BusPosition{
+						TripID:    tripID,
+						RouteID:   routeID,
+						RouteName: routeInfo.ShortName,
+						Headsign:  trip.Headsign,
+						Position:  pos,
+						Color:     routeInfo.Color,
+					}
+					applyRealtimeFields(&bp, rt)
+					result = append(result, bp)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// 範囲内の運行中バス位置のみを計算
+func (f *Feed) calculateBusPositionsInBounds(minLat, maxLat, minLng, maxLng float64) []BusPosition {
+	_, nowSec := f.nowInFeed()
+
+	result := []BusPosition{}
+
+	for routeID, trips := range f.Timetables {
+		for tripID, trip := range trips {
+			// サービス運行チェック
+			if !f.isServiceRunningToday(trip.ServiceID) {
+				continue
+			}
+
+			stops := trip.Stops
+			if len(stops) < 2 {
+				continue
+			}
+
+			// 運行時間内かチェック
+			startSec := timeToSec(stops[0].Time)
+			endSec := timeToSec(stops[len(stops)-1].Time)
+
+			if nowSec >= startSec && nowSec <= endSec {
+				// パターンキーを生成
+				stopIDs := make([]string, len(stops))
+				for i, stop := range stops {
+					stopIDs[i] = stop.StopID
+				}
+				patternKey := strings.Join(stopIDs, "|")
+
+				// 位置計算（GTFS-RT の実測値があれば優先）
+				pos, rt := f.resolveBusPosition(tripID, trip, nowSec, patternKey)
+				if len(pos) >= 2 {
+					// 範囲内チェック
+					lat := pos[1]
+					lng := pos[0]
+					if lat >= minLat && lat <= maxLat && lng >= minLng && lng <= maxLng {
+						routeInfo := f.Routes[routeID]
+						bp := BusPosition{
+							TripID:    tripID,
+							RouteID:   routeID,
+							RouteName: routeInfo.ShortName,
+							Headsign:  trip.Headsign,
+							Position:  pos,
+							Color:     routeInfo.Color,
+						}
+						applyRealtimeFields(&bp, rt)
+						result = append(result, bp)
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// findNearestStops は (lat, lng) から radius メートル以内のバス停を近い順に
+// limit 件返す。まずバウンディングボックスで粗く絞り込んでから haversine で
+// 正確な距離を計算することで、全件総当たりの計算量を抑える。
+// 経度方向の絞り込みにも degreesPerMeter をそのまま使うため、東西方向に
+// radius 近くまで離れたバス停は radius 以内でも候補から外れることがある。
+func (f *Feed) findNearestStops(lat, lng, radiusMeters float64, limit int) []StopWithDistance {
+	deg := radiusMeters * degreesPerMeter
+	minLat, maxLat := lat-deg, lat+deg
+	minLng, maxLng := lng-deg, lng+deg
+
+	candidates := make([]StopWithDistance, 0)
+	for stopID, stop := range f.Stops {
+		if stop.Lat < minLat || stop.Lat > maxLat || stop.Lng < minLng || stop.Lng > maxLng {
+			continue
+		}
+		d := geo.HaversineMeters(lat, lng, stop.Lat, stop.Lng)
+		if d > radiusMeters {
+			continue
+		}
+		candidates = append(candidates, StopWithDistance{
+			StopID:         stopID,
+			StopInfo:       stop,
+			DistanceMeters: d,
+			FeedID:         f.ID,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].DistanceMeters < candidates[j].DistanceMeters
+	})
+
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// findNearestBuses は現在運行中の全便について、ユーザー地点を経路形状に投影し、
+// 投影点以降で最初に通過する停留所までの徒歩距離と、その停留所へのバスの
+// 到着見込み秒数（ETA）を算出する。ETA は resolveBusPosition が使うのと同じ
+// 時刻表（TripUpdate の遅延があれば反映済みのもの）から求めるため、position/
+// speed 等の実測値と矛盾しない。
+func (f *Feed) findNearestBuses(lat, lng, radiusMeters float64) []NearbyBus {
+	_, nowSec := f.nowInFeed()
+
+	deg := radiusMeters * degreesPerMeter
+	minLat, maxLat := lat-deg, lat+deg
+	minLng, maxLng := lng-deg, lng+deg
+
+	result := make([]NearbyBus, 0)
+
+	for routeID, trips := range f.Timetables {
+		for tripID, trip := range trips {
+			if !f.isServiceRunningToday(trip.ServiceID) {
+				continue
+			}
+
+			stops := trip.Stops
+			if len(stops) < 2 {
+				continue
+			}
+
+			startSec := timeToSec(stops[0].Time)
+			endSec := timeToSec(stops[len(stops)-1].Time)
+			if nowSec < startSec || nowSec > endSec {
+				continue
+			}
+
+			stopIDs := make([]string, len(stops))
+			for i, s := range stops {
+				stopIDs[i] = s.StopID
+			}
+			patternKey := strings.Join(stopIDs, "|")
+
+			shape, ok := f.Shapes[patternKey]
+			if !ok || len(shape.Coordinates) == 0 {
+				continue
+			}
+
+			// バウンディングボックスで粗く絞り込み、経路全体が遠い便の投影計算を避ける
+			if !shapeIntersectsBounds(shape, minLat, maxLat, minLng, maxLng) {
+				continue
+			}
+
+			proj := geo.DistanceFromLineString([2]float64{lng, lat}, shape.Coordinates)
+			if proj.DistanceMeters > radiusMeters {
+				continue
+			}
+
+			pos, rt := f.resolveBusPosition(tripID, trip, nowSec, patternKey)
+			if pos == nil {
+				continue
+			}
+
+			// ETA は位置計算と同じ前提で求める。TripUpdate による遅延があれば
+			// resolveBusPosition と同様に時刻表へ反映してから使う。
+			etaStops := stops
+			if rt == nil {
+				if rec, ok := f.Realtime.Get(tripID); ok && rec.TripUpdate != nil {
+					etaStops = applyDelayToStops(stops, rec.TripUpdate.DelaySec)
+				}
+			}
+
+			// 投影点以降で最初に通過する停留所を探す
+			stopIdx := -1
+			for i, shapeIdx := range shape.StopIndices {
+				if shapeIdx >= proj.ClosestIndex && timeToSec(etaStops[i].Time) >= nowSec {
+					stopIdx = i
+					break
+				}
+			}
+			if stopIdx < 0 {
+				continue
+			}
+
+			nearestStop, ok := f.Stops[stops[stopIdx].StopID]
+			if !ok {
+				continue
+			}
+
+			routeInfo := f.Routes[routeID]
+			bp := BusPosition{
+				TripID:    tripID,
+				RouteID:   routeID,
+				RouteName: routeInfo.ShortName,
+				Headsign:  trip.Headsign,
+				Position:  pos,
+				Color:     routeInfo.Color,
+			}
+			applyRealtimeFields(&bp, rt)
+
+			result = append(result, NearbyBus{
+				BusPosition:   bp,
+				NearestStopID: stops[stopIdx].StopID,
+				WalkDistanceM: geo.HaversineMeters(lat, lng, nearestStop.Lat, nearestStop.Lng),
+				EtaSec:        timeToSec(etaStops[stopIdx].Time) - nowSec,
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].WalkDistanceM < result[j].WalkDistanceM
+	})
+
+	return result
+}
+
+// shapeIntersectsBounds は形状の座標列が与えられたバウンディングボックスと
+// 交差しうるか（1点でも含まれるか）を粗く判定する。全件投影計算の前置フィルタ。
+func shapeIntersectsBounds(shape ShapeData, minLat, maxLat, minLng, maxLng float64) bool {
+	for _, c := range shape.Coordinates {
+		lng, lat := c[0], c[1]
+		if lat >= minLat && lat <= maxLat && lng >= minLng && lng <= maxLng {
+			return true
+		}
+	}
+	return false
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
-	"encoding/json"
+	"fmt"
 	"log"
-	"math"
 	"net/http"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+
+	"github.com/Haruday0/sendai-bus-map-v2/realtime"
 )
 
 // StopInfo は1つのバス停情報を表す構造体
@@ -112,108 +113,39 @@ type BusPosition struct {
 	Headsign  string    `json:"headsign"`
 	Position  []float64 `json:"position"` // [lng, lat]
 	Color     string    `json:"color"`
-}
-
-// グローバル変数でデータをキャッシュ
-var (
-	stopsCache      StopsData
-	timetablesCache TimetablesData
-	shapesCache     ShapesData
-	calendarCache   CalendarData
-	extraCache      ExtraData
-	routesCache     RoutesData
-)
 
-// 起動時にバス停データを読み込む
-func loadStopsData() error {
-	file, err := os.ReadFile("../data/stops.json")
-	if err != nil {
-		return err
-	}
-
-	err = json.Unmarshal(file, &stopsCache)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("バス停データを読み込みました: %d件", len(stopsCache))
-	return nil
+	// IsRealtime が true の場合、Position は GTFS-RT の VehiclePosition から得た
+	// 実測値であり、以下のフィールドも RT レコードに由来する。
+	IsRealtime      bool    `json:"is_realtime,omitempty"`
+	Speed           float64 `json:"speed,omitempty"`
+	Bearing         float64 `json:"bearing,omitempty"`
+	OccupancyStatus string  `json:"occupancy_status,omitempty"`
+	TimestampAgeSec int64   `json:"timestamp_age_sec,omitempty"`
 }
 
-// 起動時に全データを読み込む
-func loadAllData() error {
-	// stops
-	if err := loadStopsData(); err != nil {
-		return err
-	}
-
-	// timetables
-	file, err := os.ReadFile("../data/timetables.json")
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(file, &timetablesCache); err != nil {
-		return err
-	}
-	log.Printf("時刻表データを読み込みました")
-
-	// shapes
-	file, err = os.ReadFile("../data/shapes.json")
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(file, &shapesCache); err != nil {
-		return err
-	}
-	log.Printf("経路データを読み込みました: %d件", len(shapesCache))
-
-	// calendar
-	file, err = os.ReadFile("../data/calendar.json")
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(file, &calendarCache); err != nil {
-		return err
-	}
-	log.Printf("カレンダーデータを読み込みました: %d件", len(calendarCache))
-
-	// extra
-	file, err = os.ReadFile("../data/extra.json")
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(file, &extraCache); err != nil {
-		return err
-	}
-	log.Printf("拡張データを読み込みました")
-
-	// routes
-	file, err = os.ReadFile("../data/routes.json")
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal(file, &routesCache); err != nil {
-		return err
-	}
-	log.Printf("路線データを読み込みました: %d件", len(routesCache))
-
-	return nil
+// StopWithDistance は最寄りバス停検索のレスポンス要素
+type StopWithDistance struct {
+	StopID string `json:"stop_id"`
+	StopInfo
+	DistanceMeters float64 `json:"distance_m"`
+	// FeedID はクロスフィード検索（フィード未指定の /api/stops/nearest）で
+	// どのフィードから来た結果かを示す。単一フィード指定の場合も常に埋める。
+	FeedID string `json:"feed_id"`
 }
 
-// 範囲内のバス停をフィルタリング
-func filterStopsByBounds(minLat, maxLat, minLng, maxLng float64) map[string]StopInfo {
-	result := make(map[string]StopInfo)
-
-	for stopID, stop := range stopsCache {
-		if stop.Lat >= minLat && stop.Lat <= maxLat &&
-			stop.Lng >= minLng && stop.Lng <= maxLng {
-			result[stopID] = stop
-		}
-	}
-
-	return result
+// NearbyBus は最寄りバス検索のレスポンス要素。ユーザーが乗車するために
+// 向かうべき直近の停留所と、その停留所までの徒歩距離・バスの到着見込み秒数を含む。
+type NearbyBus struct {
+	BusPosition
+	NearestStopID string  `json:"nearest_stop_id"`
+	WalkDistanceM float64 `json:"walk_distance_m"`
+	EtaSec        int     `json:"eta_sec"`
 }
 
+// degreesPerMeter は緯度経度のバウンディングボックスを作るための粗い換算値。
+// 赤道での1度 ≒ 111000m を使う（事前フィルタなので多少の誤差は許容する）。
+const degreesPerMeter = 1.0 / 111000.0
+
 // 時刻文字列 "HH:MM:SS" を秒数に変換
 func timeToSec(t string) int {
 	parts := strings.Split(t, ":")
@@ -229,207 +161,193 @@ func timeToSec(t string) int {
 	return hours*3600 + minutes*60 + seconds
 }
 
-// 現在のサービスが運行中かチェック
-func isServiceRunningToday(serviceID string) bool {
-	now := time.Now()
-	ymd := now.Format("20060102")
+// 秒数を "HH:MM:SS" 形式の時刻文字列に変換（timeToSec の逆変換）
+func secToTime(sec int) string {
+	if sec < 0 {
+		sec = 0
+	}
+	hours := sec / 3600
+	minutes := (sec % 3600) / 60
+	seconds := sec % 60
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+}
 
-	// 例外日チェック
-	for _, exception := range extraCache.CalendarDates {
-		if exception.Date == ymd && exception.ServiceID == serviceID {
-			return exception.ExceptionType == "1"
+// GTFS-RT の TripUpdate による遅延（秒）を時刻表に反映した Stops を返す
+func applyDelayToStops(stops []TripStop, delaySec int) []TripStop {
+	if delaySec == 0 {
+		return stops
+	}
+	shifted := make([]TripStop, len(stops))
+	for i, s := range stops {
+		shifted[i] = TripStop{
+			Time:   secToTime(timeToSec(s.Time) + delaySec),
+			StopID: s.StopID,
 		}
 	}
+	return shifted
+}
 
-	// カレンダーチェック
-	cal, ok := calendarCache[serviceID]
-	if !ok {
-		return false
+// applyRealtimeFields は rt（VehiclePosition 由来の Record）があれば bp に
+// 実測値の付加情報を書き込む。rt が nil の場合（TripUpdate のみ、または
+// フィード未設定）は何もしない。
+func applyRealtimeFields(bp *BusPosition, rt *realtime.Record) {
+	if rt == nil || rt.Vehicle == nil {
+		return
 	}
+	bp.IsRealtime = true
+	bp.Speed = rt.Vehicle.Speed
+	bp.Bearing = rt.Vehicle.Bearing
+	bp.OccupancyStatus = rt.Vehicle.OccupancyStatus
+	bp.TimestampAgeSec = rt.TimestampAgeSec()
+}
 
-	if ymd >= cal.Start && ymd <= cal.End {
-		// GTFS形式: 月曜=0, 日曜=6
-		gtfsDayIdx := (int(now.Weekday()) + 6) % 7
-		if gtfsDayIdx < len(cal.Days) {
-			return cal.Days[gtfsDayIdx] == "1"
+// findNearestStopsAcrossFeeds はバウンディングボックスが (lat, lng) を含む
+// 全フィードに問い合わせ、結果を統合して距離順に並べ替える。
+func findNearestStopsAcrossFeeds(lat, lng, radiusMeters float64, limit int) []StopWithDistance {
+	all := make([]StopWithDistance, 0)
+	for _, f := range feedsCache {
+		if !f.ContainsPoint(lat, lng) {
+			continue
 		}
+		all = append(all, f.findNearestStops(lat, lng, radiusMeters, 0)...)
 	}
 
-	// 期限切れフォールバック
-	startDate, _ := time.Parse("20060102", cal.Start)
-	endDate, _ := time.Parse("20060102", cal.End)
-	durationDays := endDate.Sub(startDate).Hours() / 24
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].DistanceMeters < all[j].DistanceMeters
+	})
 
-	if durationDays >= 20 {
-		gtfsDayIdx := (int(now.Weekday()) + 6) % 7
-		if gtfsDayIdx < len(cal.Days) {
-			return cal.Days[gtfsDayIdx] == "1"
-		}
+	if limit > 0 && len(all) > limit {
+		all = all[:limit]
 	}
-
-	return false
+	return all
 }
 
-// バス位置を計算
-func calculateBusPosition(trip TripInfo, nowSec int, patternKey string) []float64 {
-	shape, ok := shapesCache[patternKey]
-	if !ok || len(shape.Coordinates) == 0 || len(shape.StopIndices) == 0 {
-		return nil
+func main() {
+	// 起動時に全フィードのデータを読み込み（フィードごとに並行ロード）
+	if err := loadFeeds("../feeds.json"); err != nil {
+		log.Fatalf("フィードの読み込みに失敗しました: %v", err)
 	}
 
-	stops := trip.Stops
-	coords := shape.Coordinates
-	indices := shape.StopIndices
-
-	for i := 0; i < len(stops)-1; i++ {
-		s1 := timeToSec(stops[i].Time)
-		s2 := timeToSec(stops[i+1].Time)
-
-		if nowSec >= s1 && nowSec < s2 {
-			timeRatio := float64(nowSec-s1) / float64(s2-s1)
-			targetIndex := int(math.Floor(float64(indices[i]) + float64(indices[i+1]-indices[i])*timeRatio))
-			if targetIndex >= len(coords) {
-				targetIndex = len(coords) - 1
-			}
-			return coords[targetIndex]
+	// フィードごとに GTFS-Realtime ポーラーを起動
+	for _, f := range feedsCache {
+		f := f
+		rtCfg, err := realtime.LoadConfig(f.DataDir + "/../config.json")
+		if err != nil {
+			log.Printf("[%s] realtime: 設定の読み込みに失敗しました: %v", f.ID, err)
 		}
+		if f.GTFSRTURL != "" {
+			rtCfg.FeedURL = f.GTFSRTURL
+		}
+		f.Realtime = realtime.NewRealtimeCache(rtCfg.StaleTTL())
+		poller := realtime.NewPoller(rtCfg, f.Realtime, func(tripID string) bool {
+			for _, trips := range f.Timetables {
+				if _, ok := trips[tripID]; ok {
+					return true
+				}
+			}
+			return false
+		})
+		go poller.Run(nil)
 	}
 
-	return nil
-}
+	// バス位置のプッシュ配信用の共有ティッカーを起動（既定フィードが対象）
+	busHub := newBusStreamHub(defaultFeed)
+	go busHub.run(streamIntervalFromEnv(), nil)
 
-// 現在運行中のバス位置を全て計算
-func calculateAllBusPositions() []BusPosition {
-	now := time.Now()
-	nowSec := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	r := gin.Default()
 
-	result := []BusPosition{}
+	// CORS設定：フロントエンドからのアクセスを許可
+	r.Use(cors.Default())
 
-	for routeID, trips := range timetablesCache {
-		for tripID, trip := range trips {
-			// サービス運行チェック
-			if !isServiceRunningToday(trip.ServiceID) {
-				continue
-			}
+	registerStreamRoutes(r, busHub)
+	registerCacheAdminRoutes(r)
 
-			stops := trip.Stops
-			if len(stops) < 2 {
-				continue
-			}
+	// 設定済みフィード一覧を返すエンドポイント
+	r.GET("/api/feeds", func(c *gin.Context) {
+		summaries := make([]FeedSummary, 0, len(feedsCache))
+		for _, f := range feedsCache {
+			summaries = append(summaries, f.Summary())
+		}
+		sort.Slice(summaries, func(i, j int) bool { return summaries[i].FeedID < summaries[j].FeedID })
+		c.JSON(http.StatusOK, gin.H{"feeds": summaries})
+	})
 
-			// 運行時間内かチェック
-			startSec := timeToSec(stops[0].Time)
-			endSec := timeToSec(stops[len(stops)-1].Time)
+	// クロスフィードの最寄りバス停検索（フィード未指定）
+	r.GET("/api/stops/nearest", func(c *gin.Context) {
+		lat, err1 := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, err2 := strconv.ParseFloat(c.Query("lng"), 64)
+		if err1 != nil || err2 != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "lat, lng パラメータが必要です",
+			})
+			return
+		}
 
-			if nowSec >= startSec && nowSec <= endSec {
-				// パターンキーを生成
-				stopIDs := make([]string, len(stops))
-				for i, stop := range stops {
-					stopIDs[i] = stop.StopID
-				}
-				patternKey := strings.Join(stopIDs, "|")
-
-				// 位置計算
-				pos := calculateBusPosition(trip, nowSec, patternKey)
-				if pos != nil {
-					routeInfo := routesCache[routeID]
-					result = append(result, BusPosition{
-						TripID:    tripID,
-						RouteID:   routeID,
-						RouteName: routeInfo.ShortName,
-						Headsign:  trip.Headsign,
-						Position:  pos,
-						Color:     routeInfo.Color,
-					})
-				}
+		radius := 500.0
+		if v := c.Query("radius"); v != "" {
+			if r, err := strconv.ParseFloat(v, 64); err == nil {
+				radius = r
 			}
 		}
-	}
-
-	return result
-}
-
-// 範囲内の運行中バス位置のみを計算
-func calculateBusPositionsInBounds(minLat, maxLat, minLng, maxLng float64) []BusPosition {
-	now := time.Now()
-	nowSec := now.Hour()*3600 + now.Minute()*60 + now.Second()
 
-	result := []BusPosition{}
-
-	for routeID, trips := range timetablesCache {
-		for tripID, trip := range trips {
-			// サービス運行チェック
-			if !isServiceRunningToday(trip.ServiceID) {
-				continue
+		limit := 10
+		if v := c.Query("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				limit = n
 			}
+		}
 
-			stops := trip.Stops
-			if len(stops) < 2 {
-				continue
-			}
+		stops := findNearestStopsAcrossFeeds(lat, lng, radius, limit)
 
-			// 運行時間内かチェック
-			startSec := timeToSec(stops[0].Time)
-			endSec := timeToSec(stops[len(stops)-1].Time)
+		c.JSON(http.StatusOK, gin.H{
+			"count": len(stops),
+			"stops": stops,
+		})
+	})
 
-			if nowSec >= startSec && nowSec <= endSec {
-				// パターンキーを生成
-				stopIDs := make([]string, len(stops))
-				for i, stop := range stops {
-					stopIDs[i] = stop.StopID
-				}
-				patternKey := strings.Join(stopIDs, "|")
-
-				// 位置計算
-				pos := calculateBusPosition(trip, nowSec, patternKey)
-				if len(pos) >= 2 {
-					// 範囲内チェック
-					lat := pos[1]
-					lng := pos[0]
-					if lat >= minLat && lat <= maxLat && lng >= minLng && lng <= maxLng {
-						routeInfo := routesCache[routeID]
-						result = append(result, BusPosition{
-							TripID:    tripID,
-							RouteID:   routeID,
-							RouteName: routeInfo.ShortName,
-							Headsign:  trip.Headsign,
-							Position:  pos,
-							Color:     routeInfo.Color,
-						})
-					}
-				}
-			}
-		}
-	}
+	// フィード単体のエンドポイント群。フィード指定ありは /api/:feedId/...、
+	// 後方互換の単一フィード構成では /api/... でも同じハンドラが既定フィードに
+	// 解決される。
+	registerFeedRoutes(r.Group("/api/:feedId"))
+	registerFeedRoutes(r.Group("/api"))
 
-	return result
+	log.Println("サーバーを起動します: http://localhost:8080")
+	r.Run(":8080")
 }
 
-func main() {
-	// 起動時に全データを読み込み
-	if err := loadAllData(); err != nil {
-		log.Fatalf("データの読み込みに失敗しました: %v", err)
-	}
-
-	r := gin.Default()
-
-	// CORS設定：フロントエンドからのアクセスを許可
-	r.Use(cors.Default())
+// registerFeedRoutes はフィードに紐づくエンドポイント一式を group に登録する。
+// group が "/api/:feedId" か "/api"（後方互換、既定フィードに解決）かは
+// resolveFeed が c.Param("feedId") の有無で吸収する。
+//
+// "/api" 側（feedId なし）では "/stops/nearest" を登録しない。この literal
+// path は main() が既にクロスフィード検索用に "/api/stops/nearest" へ
+// 登録済みで、ここでも登録すると gin がルート重複でパニックする。
+func registerFeedRoutes(group *gin.RouterGroup) {
+	hasFeedIDParam := strings.Contains(group.BasePath(), ":feedId")
 
 	// 全バス停データを返すエンドポイント
-	r.GET("/api/stops", func(c *gin.Context) {
-		c.JSON(http.StatusOK, stopsCache)
+	group.GET("/stops", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+		cacheJSON(f.ID+":stops", stopsCacheTTL, c, func() (interface{}, error) {
+			return f.Stops, nil
+		})
 	})
 
 	// 範囲指定でバス停を検索するエンドポイント
-	r.GET("/api/stops/search", func(c *gin.Context) {
-		// クエリパラメータを取得
+	group.GET("/stops/search", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+
 		minLatStr := c.Query("minLat")
 		maxLatStr := c.Query("maxLat")
 		minLngStr := c.Query("minLng")
 		maxLngStr := c.Query("maxLng")
 
-		// パラメータの検証
 		if minLatStr == "" || maxLatStr == "" || minLngStr == "" || maxLngStr == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "minLat, maxLat, minLng, maxLng パラメータが必要です",
@@ -437,7 +355,6 @@ func main() {
 			return
 		}
 
-		// 文字列を数値に変換
 		minLat, err1 := strconv.ParseFloat(minLatStr, 64)
 		maxLat, err2 := strconv.ParseFloat(maxLatStr, 64)
 		minLng, err3 := strconv.ParseFloat(minLngStr, 64)
@@ -450,7 +367,6 @@ func main() {
 			return
 		}
 
-		// 範囲の妥当性チェック
 		if minLat > maxLat || minLng > maxLng {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "範囲指定が不正です（min > max）",
@@ -458,8 +374,7 @@ func main() {
 			return
 		}
 
-		// フィルタリング実行
-		filteredStops := filterStopsByBounds(minLat, maxLat, minLng, maxLng)
+		filteredStops := f.filterStopsByBounds(minLat, maxLat, minLng, maxLng)
 
 		c.JSON(http.StatusOK, gin.H{
 			"count": len(filteredStops),
@@ -467,17 +382,60 @@ func main() {
 		})
 	})
 
+	// 最寄りバス停を検索するエンドポイント（フィード内限定）。feedId なしの
+	// "/api" 側では登録しない（上のコメント参照、main() のクロスフィード
+	// ハンドラが同じ literal path を担う）。
+	if hasFeedIDParam {
+		group.GET("/stops/nearest", func(c *gin.Context) {
+			f, ok := resolveFeed(c)
+			if !ok {
+				return
+			}
+
+			lat, err1 := strconv.ParseFloat(c.Query("lat"), 64)
+			lng, err2 := strconv.ParseFloat(c.Query("lng"), 64)
+			if err1 != nil || err2 != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "lat, lng パラメータが必要です",
+				})
+				return
+			}
+
+			radius := 500.0
+			if v := c.Query("radius"); v != "" {
+				if r, err := strconv.ParseFloat(v, 64); err == nil {
+					radius = r
+				}
+			}
+
+			limit := 10
+			if v := c.Query("limit"); v != "" {
+				if n, err := strconv.Atoi(v); err == nil {
+					limit = n
+				}
+			}
+
+			stops := f.findNearestStops(lat, lng, radius, limit)
+
+			c.JSON(http.StatusOK, gin.H{
+				"count": len(stops),
+				"stops": stops,
+			})
+		})
+	}
+
 	// 現在運行中のバス位置を返すエンドポイント（範囲指定オプション）
-	r.GET("/api/buses", func(c *gin.Context) {
-		// クエリパラメータを取得（オプション）
+	group.GET("/buses", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+
 		minLatStr := c.Query("minLat")
 		maxLatStr := c.Query("maxLat")
 		minLngStr := c.Query("minLng")
 		maxLngStr := c.Query("maxLng")
 
-		var buses []BusPosition
-
-		// 範囲指定がある場合はフィルタリング
 		if minLatStr != "" && maxLatStr != "" && minLngStr != "" && maxLngStr != "" {
 			minLat, err1 := strconv.ParseFloat(minLatStr, 64)
 			maxLat, err2 := strconv.ParseFloat(maxLatStr, 64)
@@ -498,29 +456,99 @@ func main() {
 				return
 			}
 
-			buses = calculateBusPositionsInBounds(minLat, maxLat, minLng, maxLng)
+			cacheKey := fmt.Sprintf("%s:buses:%s:%s:%s:%s", f.ID, minLatStr, maxLatStr, minLngStr, maxLngStr)
+			cacheJSON(cacheKey, busesCacheTTL, c, func() (interface{}, error) {
+				buses := f.calculateBusPositionsInBounds(minLat, maxLat, minLng, maxLng)
+
+				// デバッグログ: 受け取った範囲と返却数を出力
+				log.Printf("[%s] /buses bounds received: minLat=%f maxLat=%f minLng=%f maxLng=%f -> returned=%d\n", f.ID, minLat, maxLat, minLng, maxLng, len(buses))
+
+				return gin.H{
+					"count":     len(buses),
+					"buses":     buses,
+					"timestamp": time.Now().Unix(),
+				}, nil
+			})
+			return
+		}
+
+		// 範囲指定なしの場合は全バスを返す
+		cacheJSON(f.ID+":buses:all", busesCacheTTL, c, func() (interface{}, error) {
+			buses := f.calculateAllBusPositions()
+			return gin.H{
+				"count":     len(buses),
+				"buses":     buses,
+				"timestamp": time.Now().Unix(),
+			}, nil
+		})
+	})
+
+	// ユーザー地点に接近中のバスを検索するエンドポイント
+	group.GET("/buses/nearest", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+
+		lat, err1 := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, err2 := strconv.ParseFloat(c.Query("lng"), 64)
+		if err1 != nil || err2 != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "lat, lng パラメータが必要です",
+			})
+			return
+		}
+
+		radius := 500.0
+		if v := c.Query("radius"); v != "" {
+			if r, err := strconv.ParseFloat(v, 64); err == nil {
+				radius = r
+			}
+		}
+
+		buses := f.findNearestBuses(lat, lng, radius)
+
+		c.JSON(http.StatusOK, gin.H{
+			"count": len(buses),
+			"buses": buses,
+		})
+	})
+
+	// 指定便の GTFS-RT 生レコードを返すエンドポイント
+	group.GET("/buses/:tripId/realtime", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+		tripID := c.Param("tripId")
 
-			// デバッグログ: 受け取った範囲と返却数を出力
-			log.Printf("/api/buses bounds received: minLat=%f maxLat=%f minLng=%f maxLng=%f -> returned=%d\n", minLat, maxLat, minLng, maxLng, len(buses))
-		} else {
-			// 範囲指定なしの場合は全バスを返す
-			buses = calculateAllBusPositions()
+		rec, ok := f.Realtime.Get(tripID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "この便のリアルタイム情報はありません",
+			})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"count":     len(buses),
-			"buses":     buses,
-			"timestamp": time.Now().Unix(),
+			"trip_id":           tripID,
+			"vehicle":           rec.Vehicle,
+			"trip_update":       rec.TripUpdate,
+			"timestamp_age_sec": rec.TimestampAgeSec(),
 		})
 	})
 
 	// 便詳細を返すエンドポイント（全停車バス停情報を含む）
-	r.GET("/api/trips/:routeId/:tripId", func(c *gin.Context) {
+	group.GET("/trips/:routeId/:tripId", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
 		routeID := c.Param("routeId")
 		tripID := c.Param("tripId")
 
 		// 便データを取得
-		routeTrips, ok := timetablesCache[routeID]
+		routeTrips, ok := f.Timetables[routeID]
 		if !ok {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "指定された路線が見つかりません",
@@ -539,7 +567,7 @@ func main() {
 		// この便が停車する全バス停情報を収集
 		tripStops := make(StopsData)
 		for _, ts := range trip.Stops {
-			if stop, exists := stopsCache[ts.StopID]; exists {
+			if stop, exists := f.Stops[ts.StopID]; exists {
 				tripStops[ts.StopID] = stop
 			}
 		}
@@ -550,32 +578,36 @@ func main() {
 			stopIDs[i] = stop.StopID
 		}
 		patternKey := strings.Join(stopIDs, "|")
-		shape := shapesCache[patternKey]
+		shape := f.Shapes[patternKey]
 
 		// 路線情報を取得
-		routeInfo := routesCache[routeID]
-		officeName := extraCache.Offices[trip.OfficeID]
-
-		response := TripDetailResponse{
-			TripID:     tripID,
-			RouteID:    routeID,
-			RouteName:  routeInfo.ShortName,
-			RouteColor: routeInfo.Color,
-			Trip:       trip,
-			Stops:      tripStops,
-			Shape:      &shape,
-			OfficeName: officeName,
-		}
-
-		c.JSON(http.StatusOK, response)
+		routeInfo := f.Routes[routeID]
+		officeName := f.Extra.Offices[trip.OfficeID]
+
+		cacheJSON(fmt.Sprintf("%s:trip:%s:%s", f.ID, routeID, tripID), tripCacheTTL, c, func() (interface{}, error) {
+			return TripDetailResponse{
+				TripID:     tripID,
+				RouteID:    routeID,
+				RouteName:  routeInfo.ShortName,
+				RouteColor: routeInfo.Color,
+				Trip:       trip,
+				Stops:      tripStops,
+				Shape:      &shape,
+				OfficeName: officeName,
+			}, nil
+		})
 	})
 
 	// バス停の時刻表を返すエンドポイント
-	r.GET("/api/stops/:stopId/timetable", func(c *gin.Context) {
+	group.GET("/stops/:stopId/timetable", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
 		stopID := c.Param("stopId")
 
 		// バス停情報を取得
-		stop, ok := stopsCache[stopID]
+		stop, ok := f.Stops[stopID]
 		if !ok {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "指定されたバス停が見つかりません",
@@ -585,7 +617,7 @@ func main() {
 
 		// このバス停に停車する便をフィルタリング
 		filteredTimetables := make(map[string]map[string]TripInfo)
-		for routeID, trips := range timetablesCache {
+		for routeID, trips := range f.Timetables {
 			for tripID, trip := range trips {
 				for _, ts := range trip.Stops {
 					if ts.StopID == stopID {
@@ -599,30 +631,106 @@ func main() {
 			}
 		}
 
-		response := StopTimetableResponse{
-			StopID:     stopID,
-			StopName:   stop.Name,
-			Timetables: filteredTimetables,
-		}
-
-		c.JSON(http.StatusOK, response)
+		cacheJSON(fmt.Sprintf("%s:timetable:%s", f.ID, stopID), timetableCacheTTL, c, func() (interface{}, error) {
+			return StopTimetableResponse{
+				StopID:     stopID,
+				StopName:   stop.Name,
+				Timetables: filteredTimetables,
+			}, nil
+		})
 	})
 
 	// カレンダーデータを返すエンドポイント
-	r.GET("/api/calendar", func(c *gin.Context) {
-		c.JSON(http.StatusOK, calendarCache)
+	group.GET("/calendar", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, f.Calendar)
 	})
 
 	// 路線データを返すエンドポイント
-	r.GET("/api/routes", func(c *gin.Context) {
-		c.JSON(http.StatusOK, routesCache)
+	group.GET("/routes", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, f.Routes)
 	})
 
 	// 拡張データを返すエンドポイント
-	r.GET("/api/extra", func(c *gin.Context) {
-		c.JSON(http.StatusOK, extraCache)
+	group.GET("/extra", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, f.Extra)
 	})
 
-	log.Println("サーバーを起動します: http://localhost:8080")
-	r.Run(":8080")
+	// 2つのバス停間の経路を検索するエンドポイント（RAPTORアルゴリズム）
+	group.GET("/journey", func(c *gin.Context) {
+		f, ok := resolveFeed(c)
+		if !ok {
+			return
+		}
+
+		fromStopID := c.Query("from")
+		toStopID := c.Query("to")
+		if fromStopID == "" || toStopID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "from, to パラメータが必要です",
+			})
+			return
+		}
+		if _, exists := f.Stops[fromStopID]; !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された出発バス停が見つかりません"})
+			return
+		}
+		if _, exists := f.Stops[toStopID]; !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指定された到着バス停が見つかりません"})
+			return
+		}
+
+		now, nowSec := f.nowInFeed()
+
+		date := now
+		if v := c.Query("date"); v != "" {
+			parsed, err := time.ParseInLocation("20060102", v, f.Location)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date は YYYYMMDD 形式で指定してください"})
+				return
+			}
+			date = parsed
+		}
+
+		departureSec := nowSec
+		if v := c.Query("departure"); v != "" {
+			parts := strings.Split(v, ":")
+			hours, err1 := strconv.Atoi(parts[0])
+			var minutes int
+			var err2 error
+			if len(parts) == 2 {
+				minutes, err2 = strconv.Atoi(parts[1])
+			}
+			if len(parts) != 2 || err1 != nil || err2 != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "departure は HH:MM 形式で指定してください"})
+				return
+			}
+			departureSec = hours*3600 + minutes*60
+		}
+
+		maxTransfers := defaultMaxTransfers
+		if v := c.Query("maxTransfers"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				maxTransfers = n
+			}
+		}
+
+		itineraries := f.PlanJourney(fromStopID, toStopID, departureSec, date, maxTransfers)
+
+		c.JSON(http.StatusOK, gin.H{
+			"count":       len(itineraries),
+			"itineraries": itineraries,
+		})
+	})
 }
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Haruday0/sendai-bus-map-v2/geo"
+)
+
+// maxWalkTransferMeters はバス停間の徒歩乗換を許す最大距離。
+const maxWalkTransferMeters = 400.0
+
+// walkSpeedMetersPerSec は徒歩乗換の所要時間を見積もる際の歩行速度。
+const walkSpeedMetersPerSec = 1.2
+
+// defaultMaxTransfers は /journey で maxTransfers 未指定時の最大乗換回数（RAPTOR の K）。
+// ラウンドは 0 から K までの K+1 回走る。
+const defaultMaxTransfers = 3
+
+// raptorInfinity は「未到達」を表す十分大きな秒数。
+const raptorInfinity = 1 << 30
+
+// raptorTrip はRAPTORの1便分。StopTimes は route.StopIDs と同じ並びの通過秒数。
+type raptorTrip struct {
+	TripID    string
+	ServiceID string
+	StopTimes []int
+}
+
+// raptorRoute は同一路線・同一停車パターンの便をまとめたもの（RAPTORの「ルート」）。
+// Trips は最初の停留所の出発時刻順にソートされる。
+type raptorRoute struct {
+	RouteID string
+	StopIDs []string
+	Trips   []raptorTrip
+}
+
+// raptorTransfer は徒歩で乗り換え可能な隣接バス停と、その所要時間。
+type raptorTransfer struct {
+	StopID      string
+	DurationSec int
+}
+
+// raptorTables はRAPTORアルゴリズムが参照する前処理済みデータ一式。
+type raptorTables struct {
+	routes       []raptorRoute
+	routesAtStop map[string][]int // stop_id -> routes のインデックス一覧
+	transfers    map[string][]raptorTransfer
+}
+
+// raptorTables はこのフィードの前処理済みRAPTORテーブルを返す。初回呼び出し時
+// にのみ構築し、以降はキャッシュを使い回す。
+func (f *Feed) raptorTables() *raptorTables {
+	f.raptorOnce.Do(func() {
+		f.raptorCache = buildRaptorTables(f)
+	})
+	return f.raptorCache
+}
+
+// buildRaptorTables は Timetables を route_id+停車パターンごとにまとめ、
+// routes_at_stop と徒歩乗換テーブルを前計算する。
+func buildRaptorTables(f *Feed) *raptorTables {
+	routesByKey := make(map[string]*raptorRoute)
+	order := make([]string, 0)
+
+	for routeID, trips := range f.Timetables {
+		for tripID, trip := range trips {
+			if len(trip.Stops) < 2 {
+				continue
+			}
+			stopIDs := make([]string, len(trip.Stops))
+			stopTimes := make([]int, len(trip.Stops))
+			for i, ts := range trip.Stops {
+				stopIDs[i] = ts.StopID
+				stopTimes[i] = timeToSec(ts.Time)
+			}
+
+			key := routeID + "|" + strings.Join(stopIDs, "|")
+			r, ok := routesByKey[key]
+			if !ok {
+				r = &raptorRoute{RouteID: routeID, StopIDs: stopIDs}
+				routesByKey[key] = r
+				order = append(order, key)
+			}
+			r.Trips = append(r.Trips, raptorTrip{
+				TripID:    tripID,
+				ServiceID: trip.ServiceID,
+				StopTimes: stopTimes,
+			})
+		}
+	}
+
+	routes := make([]raptorRoute, 0, len(order))
+	for _, key := range order {
+		r := routesByKey[key]
+		sort.Slice(r.Trips, func(i, j int) bool {
+			return r.Trips[i].StopTimes[0] < r.Trips[j].StopTimes[0]
+		})
+		routes = append(routes, *r)
+	}
+
+	routesAtStop := make(map[string][]int)
+	for idx, r := range routes {
+		seen := make(map[string]bool, len(r.StopIDs))
+		for _, stopID := range r.StopIDs {
+			if seen[stopID] {
+				continue
+			}
+			seen[stopID] = true
+			routesAtStop[stopID] = append(routesAtStop[stopID], idx)
+		}
+	}
+
+	return &raptorTables{
+		routes:       routes,
+		routesAtStop: routesAtStop,
+		transfers:    buildFootTransfers(f),
+	}
+}
+
+// buildFootTransfers は全バス停ペアの総当たりで、互いに maxWalkTransferMeters
+// 以内なら徒歩乗換ができるものとして所要時間を記録する。起動後の初回クエリ時
+// に一度だけ行う前処理であり、毎リクエストでは計算しない。
+func buildFootTransfers(f *Feed) map[string][]raptorTransfer {
+	stopIDs := make([]string, 0, len(f.Stops))
+	for stopID := range f.Stops {
+		stopIDs = append(stopIDs, stopID)
+	}
+
+	transfers := make(map[string][]raptorTransfer, len(stopIDs))
+	for i := 0; i < len(stopIDs); i++ {
+		a := f.Stops[stopIDs[i]]
+		for j := i + 1; j < len(stopIDs); j++ {
+			b := f.Stops[stopIDs[j]]
+			d := geo.HaversineMeters(a.Lat, a.Lng, b.Lat, b.Lng)
+			if d > maxWalkTransferMeters {
+				continue
+			}
+			duration := int(d / walkSpeedMetersPerSec)
+			transfers[stopIDs[i]] = append(transfers[stopIDs[i]], raptorTransfer{StopID: stopIDs[j], DurationSec: duration})
+			transfers[stopIDs[j]] = append(transfers[stopIDs[j]], raptorTransfer{StopID: stopIDs[i], DurationSec: duration})
+		}
+	}
+	return transfers
+}
+
+// earliestTrip は route の stopIdx 番目の停留所を afterSec 以降に出発し、
+// date の時点で運行している便のうち最も早いものを返す。
+func earliestTrip(f *Feed, route *raptorRoute, stopIdx, afterSec int, date time.Time) *raptorTrip {
+	for i := range route.Trips {
+		trip := &route.Trips[i]
+		if trip.StopTimes[stopIdx] < afterSec {
+			continue
+		}
+		if !f.isServiceRunningOn(trip.ServiceID, date) {
+			continue
+		}
+		return trip
+	}
+	return nil
+}
+
+// JourneyLeg は行程1区間分。Kind は "ride"（乗車）または "walk"（徒歩乗換）。
+type JourneyLeg struct {
+	Kind         string `json:"kind"`
+	RouteID      string `json:"route_id,omitempty"`
+	TripID       string `json:"trip_id,omitempty"`
+	BoardStopID  string `json:"board_stop_id"`
+	AlightStopID string `json:"alight_stop_id"`
+	BoardTime    string `json:"board_time"`
+	AlightTime   string `json:"alight_time"`
+}
+
+// Itinerary は出発バス停から到着バス停までの1つの行程案。
+type Itinerary struct {
+	ArrivalTime string       `json:"arrival_time"`
+	Transfers   int          `json:"transfers"`
+	Legs        []JourneyLeg `json:"legs"`
+}
+
+// raptorArrivalSource は bestArrival[stopID] をどの区間で達成したかを表す。
+// reconstructItinerary が to から from に向かって辿るための後ろ向きリンク。
+type raptorArrivalSource struct {
+	leg      JourneyLeg
+	fromStop string
+}
+
+// PlanJourney は from から to まで departureSec 以降に出発する行程を、RAPTOR
+// アルゴリズムで探索する。ラウンド r は「乗り換え r 回以内」に相当し、to への
+// 到着時刻がラウンドを追うごとに改善するたび、その時点の最速行程を
+// itineraries に積んでいく（乗り換えを増やすほど早く着けるケースを拾うため）。
+func (f *Feed) PlanJourney(fromStopID, toStopID string, departureSec int, date time.Time, maxTransfers int) []Itinerary {
+	tables := f.raptorTables()
+
+	bestArrival := map[string]int{fromStopID: departureSec}
+	source := make(map[string]raptorArrivalSource)
+	marked := map[string]bool{fromStopID: true}
+
+	itineraries := make([]Itinerary, 0)
+	bestDestArrival := raptorInfinity
+
+	for round := 0; round <= maxTransfers && len(marked) > 0; round++ {
+		updated := make(map[string]int)
+		updatedSource := make(map[string]raptorArrivalSource)
+
+		routesToScan := make(map[int]bool)
+		for stopID := range marked {
+			for _, routeIdx := range tables.routesAtStop[stopID] {
+				routesToScan[routeIdx] = true
+			}
+		}
+
+		for routeIdx := range routesToScan {
+			route := &tables.routes[routeIdx]
+
+			var boardedTrip *raptorTrip
+			boardStopID := ""
+			boardIdx := -1
+
+			for i, stopID := range route.StopIDs {
+				if boardedTrip != nil {
+					arrivalSec := boardedTrip.StopTimes[i]
+					if arrivalSec < arrivalOrInf(bestArrival, stopID) && arrivalSec < arrivalOrInf(updated, stopID) {
+						updated[stopID] = arrivalSec
+						updatedSource[stopID] = raptorArrivalSource{
+							leg: JourneyLeg{
+								Kind:         "ride",
+								RouteID:      route.RouteID,
+								TripID:       boardedTrip.TripID,
+								BoardStopID:  boardStopID,
+								AlightStopID: stopID,
+								BoardTime:    secToTime(boardedTrip.StopTimes[boardIdx]),
+								AlightTime:   secToTime(arrivalSec),
+							},
+							fromStop: boardStopID,
+						}
+					}
+				}
+
+				if !marked[stopID] {
+					continue
+				}
+				avail := arrivalOrInf(bestArrival, stopID)
+				if boardedTrip != nil && avail > boardedTrip.StopTimes[i] {
+					continue
+				}
+				candidate := earliestTrip(f, route, i, avail, date)
+				if candidate == nil {
+					continue
+				}
+				if boardedTrip == nil || candidate.StopTimes[i] < boardedTrip.StopTimes[i] {
+					boardedTrip = candidate
+					boardStopID = stopID
+					boardIdx = i
+				}
+			}
+		}
+
+		for stopID, arrivalSec := range updated {
+			if arrivalSec < arrivalOrInf(bestArrival, stopID) {
+				bestArrival[stopID] = arrivalSec
+				source[stopID] = updatedSource[stopID]
+			}
+		}
+
+		// 徒歩乗換フェーズ: このラウンドで改善した停留所から400m以内へ伝播する
+		walked := make(map[string]bool)
+		for stopID, arrivalSec := range updated {
+			for _, tr := range tables.transfers[stopID] {
+				walkArrival := arrivalSec + tr.DurationSec
+				if walkArrival < arrivalOrInf(bestArrival, tr.StopID) {
+					bestArrival[tr.StopID] = walkArrival
+					source[tr.StopID] = raptorArrivalSource{
+						leg: JourneyLeg{
+							Kind:         "walk",
+							BoardStopID:  stopID,
+							AlightStopID: tr.StopID,
+							BoardTime:    secToTime(arrivalSec),
+							AlightTime:   secToTime(walkArrival),
+						},
+						fromStop: stopID,
+					}
+					walked[tr.StopID] = true
+				}
+			}
+		}
+
+		marked = make(map[string]bool, len(updated)+len(walked))
+		for stopID := range updated {
+			marked[stopID] = true
+		}
+		for stopID := range walked {
+			marked[stopID] = true
+		}
+
+		if arr, ok := bestArrival[toStopID]; ok && arr < bestDestArrival {
+			bestDestArrival = arr
+			itineraries = append(itineraries, reconstructItinerary(source, fromStopID, toStopID, arr, round))
+		}
+	}
+
+	return itineraries
+}
+
+func arrivalOrInf(m map[string]int, stopID string) int {
+	if v, ok := m[stopID]; ok {
+		return v
+	}
+	return raptorInfinity
+}
+
+// reconstructItinerary は source のリンクを to から from まで逆向きに辿り、
+// 出発順に並べ替えた行程を組み立てる。
+func reconstructItinerary(source map[string]raptorArrivalSource, fromStopID, toStopID string, arrival, round int) Itinerary {
+	legs := make([]JourneyLeg, 0)
+	cur := toStopID
+	for cur != fromStopID {
+		src, ok := source[cur]
+		if !ok {
+			break
+		}
+		legs = append(legs, src.leg)
+		cur = src.fromStop
+	}
+	for i, j := 0, len(legs)-1; i < j; i, j = i+1, j-1 {
+		legs[i], legs[j] = legs[j], legs[i]
+	}
+	return Itinerary{
+		ArrivalTime: secToTime(arrival),
+		Transfers:   round,
+		Legs:        legs,
+	}
+}
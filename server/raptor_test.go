@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Haruday0/sendai-bus-map-v2/realtime"
+)
+
+// newTestFeed は RAPTOR テスト用の最小フィードを組み立てる。S1→A（R1）と
+// B→S2（R2）の2路線に、約17m しか離れていない A/B 間の徒歩乗換を組み合わせた
+// ケースで、ride→walk→ride の行程が正しく見つかるかを確認する。他の停留所間
+// は十分離しており、意図しない徒歩乗換が紛れ込まないようにしている。
+func newTestFeed() *Feed {
+	cal := CalendarEntry{Days: []string{"1", "1", "1", "1", "1", "1", "1"}, Start: "20200101", End: "21000101"}
+
+	return &Feed{
+		ID:       "test",
+		Location: time.UTC,
+		Realtime: realtime.NewRealtimeCache(realtime.DefaultStaleTTL),
+		Stops: StopsData{
+			"S1": {Name: "S1", Lat: 38.0000, Lng: 140.0000},
+			"A":  {Name: "A", Lat: 38.0500, Lng: 140.0500},
+			"B":  {Name: "B", Lat: 38.0500, Lng: 140.0502}, // A から約17m、他の停留所とは十分離れている
+			"S2": {Name: "S2", Lat: 38.1000, Lng: 140.1000},
+		},
+		Timetables: TimetablesData{
+			"R1": {
+				"T1": {
+					ServiceID: "WEEKDAY",
+					Stops: []TripStop{
+						{StopID: "S1", Time: "08:00:00"},
+						{StopID: "A", Time: "08:10:00"},
+					},
+				},
+			},
+			"R2": {
+				"T2": {
+					ServiceID: "WEEKDAY",
+					Stops: []TripStop{
+						{StopID: "B", Time: "08:20:00"},
+						{StopID: "S2", Time: "08:30:00"},
+					},
+				},
+			},
+		},
+		Calendar: CalendarData{"WEEKDAY": cal},
+		Extra:    ExtraData{},
+	}
+}
+
+func TestPlanJourney_RideWalkRide(t *testing.T) {
+	f := newTestFeed()
+	date := time.Date(2026, 7, 25, 0, 0, 0, 0, time.UTC)
+
+	itineraries := f.PlanJourney("S1", "S2", timeToSec("07:50:00"), date, defaultMaxTransfers)
+	if len(itineraries) == 0 {
+		t.Fatalf("expected at least one itinerary connecting S1 and S2 via a walk transfer, got none")
+	}
+
+	best := itineraries[len(itineraries)-1]
+	if best.ArrivalTime != "08:30:00" {
+		t.Errorf("arrival time = %s, want 08:30:00", best.ArrivalTime)
+	}
+
+	var kinds []string
+	for _, leg := range best.Legs {
+		kinds = append(kinds, leg.Kind)
+	}
+	want := []string{"ride", "walk", "ride"}
+	if len(kinds) != len(want) {
+		t.Fatalf("legs = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("legs = %v, want %v", kinds, want)
+			break
+		}
+	}
+}
+
+func TestPlanJourney_DirectRide(t *testing.T) {
+	f := newTestFeed()
+	date := time.Date(2026, 7, 25, 0, 0, 0, 0, time.UTC)
+
+	itineraries := f.PlanJourney("S1", "A", timeToSec("07:50:00"), date, defaultMaxTransfers)
+	if len(itineraries) == 0 {
+		t.Fatalf("expected a direct itinerary from S1 to A, got none")
+	}
+
+	best := itineraries[len(itineraries)-1]
+	if best.ArrivalTime != "08:10:00" {
+		t.Errorf("arrival time = %s, want 08:10:00", best.ArrivalTime)
+	}
+	if len(best.Legs) != 1 || best.Legs[0].Kind != "ride" {
+		t.Errorf("legs = %+v, want a single ride leg", best.Legs)
+	}
+}
+
+func TestPlanJourney_NoRoute(t *testing.T) {
+	f := newTestFeed()
+	date := time.Date(2026, 7, 25, 0, 0, 0, 0, time.UTC)
+
+	// S2 から S1 へは逆方向で、どの便にも乗れないはず。
+	itineraries := f.PlanJourney("S2", "S1", timeToSec("07:50:00"), date, defaultMaxTransfers)
+	if len(itineraries) != 0 {
+		t.Errorf("expected no itinerary from S2 to S1, got %+v", itineraries)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Haruday0/sendai-bus-map-v2/realtime"
+)
+
+func TestApplyDelayToStops_ShiftsAllStopTimes(t *testing.T) {
+	stops := []TripStop{
+		{StopID: "S1", Time: "08:00:00"},
+		{StopID: "S2", Time: "08:10:00"},
+	}
+
+	shifted := applyDelayToStops(stops, 300)
+
+	if shifted[0].Time != "08:05:00" || shifted[1].Time != "08:15:00" {
+		t.Errorf("shifted = %+v, want +5 minutes on every stop", shifted)
+	}
+	if shifted[0].StopID != "S1" || shifted[1].StopID != "S2" {
+		t.Errorf("shifted stop_ids changed: %+v", shifted)
+	}
+}
+
+func TestApplyDelayToStops_ZeroDelayReturnsSameSlice(t *testing.T) {
+	stops := []TripStop{{StopID: "S1", Time: "08:00:00"}}
+
+	shifted := applyDelayToStops(stops, 0)
+
+	if &shifted[0] != &stops[0] {
+		t.Errorf("expected zero delay to return the original slice unmodified")
+	}
+}
+
+func TestApplyDelayToStops_NegativeDelayShiftsEarlier(t *testing.T) {
+	stops := []TripStop{{StopID: "S1", Time: "08:10:00"}}
+
+	shifted := applyDelayToStops(stops, -60)
+
+	if shifted[0].Time != "08:09:00" {
+		t.Errorf("Time = %s, want 08:09:00 (ahead of schedule)", shifted[0].Time)
+	}
+}
+
+func newRTTestFeed() *Feed {
+	return &Feed{
+		ID:       "test",
+		Realtime: realtime.NewRealtimeCache(realtime.DefaultStaleTTL),
+		Shapes: ShapesData{
+			"S1|S2": {
+				Coordinates: [][]float64{{140.0, 38.0}, {140.05, 38.05}, {140.1, 38.1}},
+				StopIndices: []int{0, 2},
+			},
+		},
+	}
+}
+
+func testTrip() TripInfo {
+	return TripInfo{
+		ServiceID: "WEEKDAY",
+		Stops: []TripStop{
+			{StopID: "S1", Time: "08:00:00"},
+			{StopID: "S2", Time: "08:10:00"},
+		},
+	}
+}
+
+func TestResolveBusPosition_PrefersVehiclePositionOverSchedule(t *testing.T) {
+	f := newRTTestFeed()
+	f.Realtime.Set("T1", realtime.Record{Vehicle: &realtime.VehicleRecord{Lat: 39.0, Lng: 141.0}})
+
+	pos, rt := f.resolveBusPosition("T1", testTrip(), timeToSec("08:05:00"), "S1|S2")
+
+	if rt == nil {
+		t.Fatalf("expected a non-nil Record when a VehiclePosition is cached")
+	}
+	if pos[0] != 141.0 || pos[1] != 39.0 {
+		t.Errorf("pos = %v, want the raw GTFS-RT vehicle position [141.0, 39.0]", pos)
+	}
+}
+
+func TestResolveBusPosition_TripUpdateShiftsScheduleInterpolation(t *testing.T) {
+	f := newRTTestFeed()
+	f.Realtime.Set("T1", realtime.Record{TripUpdate: &realtime.TripUpdateRecord{DelaySec: 300}})
+
+	// 遅延を考慮しない場合、08:05:00 は区間の中間（比率0.5）だが、5分遅れを
+	// 反映すると同じ現在時刻は遅延後の区間の先頭（比率0）に相当するはず。
+	pos, rt := f.resolveBusPosition("T1", testTrip(), timeToSec("08:05:00"), "S1|S2")
+
+	if rt != nil {
+		t.Fatalf("expected a nil Record for TripUpdate-only data (no vehicle to report)")
+	}
+	if pos == nil {
+		t.Fatalf("expected a delay-adjusted interpolated position")
+	}
+	if pos[0] != 140.0 || pos[1] != 38.0 {
+		t.Errorf("pos = %v, want the shape's start point (delay pushes the bus back to the segment start)", pos)
+	}
+}
+
+func TestResolveBusPosition_FallsBackToScheduleWithoutRealtime(t *testing.T) {
+	f := newRTTestFeed()
+
+	pos, rt := f.resolveBusPosition("T1", testTrip(), timeToSec("08:05:00"), "S1|S2")
+
+	if rt != nil {
+		t.Errorf("expected a nil Record when there is no realtime data at all")
+	}
+	if pos == nil {
+		t.Fatalf("expected a schedule-interpolated position")
+	}
+	// 遅延無しなら 08:05:00 は区間の中間点。
+	if pos[0] != 140.05 || pos[1] != 38.05 {
+		t.Errorf("pos = %v, want the midpoint [140.05, 38.05]", pos)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultStreamInterval は共有ティッカーがバス位置を再計算する間隔。
+const DefaultStreamInterval = 3 * time.Second
+
+// streamHeartbeatInterval はSSE接続を挟むプロキシがアイドル接続を切断しない
+// よう定期的に送るハートビートコメントの間隔。
+const streamHeartbeatInterval = 15 * time.Second
+
+// busDiff は1ティックの間に増減・移動したバスの差分。フロントエンドはこれを
+// 使って全再描画ではなくアニメーションで反映できる。
+type busDiff struct {
+	Added   []BusPosition `json:"added"`
+	Updated []BusPosition `json:"updated"`
+	Removed []string      `json:"removed"`
+}
+
+func (d busDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+// boundsFilter は購読時に指定されたバウンディングボックス。未指定なら全件通す。
+type boundsFilter struct {
+	enabled                        bool
+	minLat, maxLat, minLng, maxLng float64
+}
+
+func (f boundsFilter) includes(bp BusPosition) bool {
+	if !f.enabled || len(bp.Position) < 2 {
+		return true
+	}
+	lat, lng := bp.Position[1], bp.Position[0]
+	return lat >= f.minLat && lat <= f.maxLat && lng >= f.minLng && lng <= f.maxLng
+}
+
+func (f boundsFilter) apply(d busDiff) busDiff {
+	if !f.enabled {
+		return d
+	}
+	out := busDiff{Removed: d.Removed}
+	for _, bp := range d.Added {
+		if f.includes(bp) {
+			out.Added = append(out.Added, bp)
+		}
+	}
+	for _, bp := range d.Updated {
+		if f.includes(bp) {
+			out.Updated = append(out.Updated, bp)
+		}
+	}
+	return out
+}
+
+// parseBoundsFilter はクエリパラメータからバウンディングボックスを読み取る。
+// 4つ全て揃っていない場合はフィルタ無し扱い。
+func parseBoundsFilter(c *gin.Context) boundsFilter {
+	minLat, err1 := strconv.ParseFloat(c.Query("minLat"), 64)
+	maxLat, err2 := strconv.ParseFloat(c.Query("maxLat"), 64)
+	minLng, err3 := strconv.ParseFloat(c.Query("minLng"), 64)
+	maxLng, err4 := strconv.ParseFloat(c.Query("maxLng"), 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return boundsFilter{}
+	}
+	return boundsFilter{enabled: true, minLat: minLat, maxLat: maxLat, minLng: minLng, maxLng: maxLng}
+}
+
+// busStreamHub は1本の共有ティッカーで全バス位置を計算し、購読中の各クライアント
+// にはバウンディングボックスで絞った差分だけを配る。クライアントごとのコストを
+// map参照＋JSONエンコードに抑え、calculateAllBusPositions を毎接続で走らせない。
+type busStreamHub struct {
+	mu          sync.Mutex
+	subscribers map[chan busDiff]boundsFilter
+	last        map[string]BusPosition
+
+	// getFeed は配信対象のフィードを返す。マルチフィード環境では既定フィード
+	// （defaultFeed）を渡す想定で、フィードごとの配信は今後の拡張余地とする。
+	getFeed func() *Feed
+}
+
+func newBusStreamHub(getFeed func() *Feed) *busStreamHub {
+	return &busStreamHub{
+		subscribers: make(map[chan busDiff]boundsFilter),
+		last:        make(map[string]BusPosition),
+		getFeed:     getFeed,
+	}
+}
+
+// subscribe はバッファ付きチャネルを登録して返す。呼び出し側は接続終了時に
+// unsubscribe を呼ぶこと。
+func (h *busStreamHub) subscribe(filter boundsFilter) chan busDiff {
+	ch := make(chan busDiff, 8)
+	h.mu.Lock()
+	h.subscribers[ch] = filter
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *busStreamHub) unsubscribe(ch chan busDiff) {
+	h.mu.Lock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// tick は calculateAllBusPositions を1回だけ実行し、前回スナップショットとの
+// 差分を計算した上で、購読者ごとにバウンディングボックスで絞って配信する。
+func (h *busStreamHub) tick() {
+	feed := h.getFeed()
+	if feed == nil {
+		return
+	}
+	buses := feed.calculateAllBusPositions()
+
+	current := make(map[string]BusPosition, len(buses))
+	for _, b := range buses {
+		current[b.TripID] = b
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	full := diffBusPositions(h.last, current)
+	h.last = current
+
+	if full.empty() {
+		return
+	}
+
+	for ch, filter := range h.subscribers {
+		diff := filter.apply(full)
+		if diff.empty() {
+			continue
+		}
+		select {
+		case ch <- diff:
+		default:
+			// クライアントの受信が追いついていない場合はこのtickをドロップし、
+			// ハブ自体がブロックしないようにする。
+			log.Printf("stream: 購読者のバッファが溢れたため1tick分をスキップしました")
+		}
+	}
+}
+
+// diffBusPositions は前回スナップショット last と今回 current を比較し、
+// 追加・更新・削除のバスをまとめる。位置が変わっていない便は Updated に
+// 含めない。
+func diffBusPositions(last, current map[string]BusPosition) busDiff {
+	var added, updated []BusPosition
+	for tripID, bp := range current {
+		prev, existed := last[tripID]
+		if !existed {
+			added = append(added, bp)
+		} else if !samePosition(prev, bp) {
+			updated = append(updated, bp)
+		}
+	}
+
+	var removed []string
+	for tripID := range last {
+		if _, ok := current[tripID]; !ok {
+			removed = append(removed, tripID)
+		}
+	}
+
+	return busDiff{Added: added, Updated: updated, Removed: removed}
+}
+
+func samePosition(a, b BusPosition) bool {
+	if len(a.Position) != 2 || len(b.Position) != 2 {
+		return false
+	}
+	return a.Position[0] == b.Position[0] && a.Position[1] == b.Position[1]
+}
+
+// run は interval ごとに tick を実行し続ける。stop がクローズされると終了する。
+func (h *busStreamHub) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// streamIntervalFromEnv は STREAM_INTERVAL_SEC からティック間隔を読む。
+// 未設定・不正値の場合は DefaultStreamInterval を使う。
+func streamIntervalFromEnv() time.Duration {
+	v := os.Getenv("STREAM_INTERVAL_SEC")
+	if v == "" {
+		return DefaultStreamInterval
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return DefaultStreamInterval
+	}
+	return time.Duration(n) * time.Second
+}
+
+// upgrader は /ws/buses 用の WebSocket アップグレーダー。フロントエンドは別
+// オリジンから配信されるため CheckOrigin は許可する（CORS 設定と同じ方針）。
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// registerStreamRoutes は SSE (/api/buses/stream) と WebSocket (/ws/buses) の
+// 両方のエンドポイントを hub に登録する。
+func registerStreamRoutes(r *gin.Engine, hub *busStreamHub) {
+	r.GET("/api/buses/stream", func(c *gin.Context) {
+		filter := parseBoundsFilter(c)
+		ch := hub.subscribe(filter)
+		defer hub.unsubscribe(ch)
+
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		ctx := c.Request.Context()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case diff, ok := <-ch:
+				if !ok {
+					return false
+				}
+				data, err := json.Marshal(diff)
+				if err != nil {
+					return false
+				}
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				return true
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	})
+
+	r.GET("/ws/buses", func(c *gin.Context) {
+		filter := parseBoundsFilter(c)
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Printf("ws: アップグレードに失敗しました: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		ch := hub.subscribe(filter)
+		defer hub.unsubscribe(ch)
+
+		ctx := c.Request.Context()
+		for {
+			select {
+			case diff, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := conn.WriteJSON(diff); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestDiffBusPositions_Added(t *testing.T) {
+	last := map[string]BusPosition{}
+	current := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.0, 38.0}},
+	}
+
+	diff := diffBusPositions(last, current)
+	if len(diff.Added) != 1 || diff.Added[0].TripID != "T1" {
+		t.Errorf("Added = %+v, want [T1]", diff.Added)
+	}
+	if len(diff.Updated) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("diff = %+v, want only Added populated", diff)
+	}
+}
+
+func TestDiffBusPositions_UpdatedWhenPositionChanges(t *testing.T) {
+	last := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.0, 38.0}},
+	}
+	current := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.001, 38.0}},
+	}
+
+	diff := diffBusPositions(last, current)
+	if len(diff.Updated) != 1 || diff.Updated[0].TripID != "T1" {
+		t.Errorf("Updated = %+v, want [T1]", diff.Updated)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("diff = %+v, want only Updated populated", diff)
+	}
+}
+
+func TestDiffBusPositions_UnchangedPositionIsNotUpdated(t *testing.T) {
+	last := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.0, 38.0}},
+	}
+	current := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.0, 38.0}},
+	}
+
+	diff := diffBusPositions(last, current)
+	if !diff.empty() {
+		t.Errorf("diff = %+v, want empty (position unchanged)", diff)
+	}
+}
+
+func TestDiffBusPositions_Removed(t *testing.T) {
+	last := map[string]BusPosition{
+		"T1": {TripID: "T1", Position: []float64{140.0, 38.0}},
+	}
+	current := map[string]BusPosition{}
+
+	diff := diffBusPositions(last, current)
+	if len(diff.Removed) != 1 || diff.Removed[0] != "T1" {
+		t.Errorf("Removed = %+v, want [T1]", diff.Removed)
+	}
+}
+
+func TestBoundsFilter_ApplyFiltersAddedAndUpdatedButNotRemoved(t *testing.T) {
+	filter := boundsFilter{enabled: true, minLat: 38.0, maxLat: 38.1, minLng: 140.0, maxLng: 140.1}
+
+	full := busDiff{
+		Added: []BusPosition{
+			{TripID: "inside", Position: []float64{140.05, 38.05}},
+			{TripID: "outside", Position: []float64{141.0, 39.0}},
+		},
+		Updated: []BusPosition{
+			{TripID: "outside", Position: []float64{141.0, 39.0}},
+		},
+		Removed: []string{"gone"},
+	}
+
+	filtered := filter.apply(full)
+	if len(filtered.Added) != 1 || filtered.Added[0].TripID != "inside" {
+		t.Errorf("Added = %+v, want only [inside]", filtered.Added)
+	}
+	if len(filtered.Updated) != 0 {
+		t.Errorf("Updated = %+v, want none (outside bounds)", filtered.Updated)
+	}
+	if len(filtered.Removed) != 1 || filtered.Removed[0] != "gone" {
+		t.Errorf("Removed = %+v, want [gone] (removals always pass through)", filtered.Removed)
+	}
+}
+
+func TestBoundsFilter_DisabledPassesEverythingThrough(t *testing.T) {
+	filter := boundsFilter{}
+	full := busDiff{
+		Added:   []BusPosition{{TripID: "T1", Position: []float64{141.0, 39.0}}},
+		Removed: []string{"T2"},
+	}
+
+	if filtered := filter.apply(full); len(filtered.Added) != 1 || len(filtered.Removed) != 1 {
+		t.Errorf("apply() with disabled filter = %+v, want unchanged", filtered)
+	}
+}